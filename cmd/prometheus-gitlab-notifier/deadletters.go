@@ -0,0 +1,86 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/deadletter"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func openDeadLetters(logger log.FieldLogger) (*deadletter.Store, error) {
+	if *deadLetterDir == "" {
+		return nil, errors.New("the --dead.letter.dir flag has to be set")
+	}
+	return deadletter.New(logger.WithField("component", "deadletter"), *deadLetterDir)
+}
+
+// listDeadLetters prints table of the alerts in the dead-letter store.
+func listDeadLetters(logger log.FieldLogger, out io.Writer) error {
+	store, err := openDeadLetters(logger)
+	if err != nil {
+		return err
+	}
+	entries, err := store.List()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDROPPED AT\tREASON\tRETRIES\tSTATUS\tGROUP KEY\tERROR")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", e.ID, e.DroppedAt.Format(time.RFC3339), e.Reason, e.RetryCount, e.Message.Status, e.Message.GroupKey, e.Error)
+	}
+	return w.Flush()
+}
+
+// replayDeadLetters creates issues from the alerts in the dead-letter store, all of them if no IDs are given.
+func replayDeadLetters(logger log.FieldLogger, ids []string) error {
+	// The replayed alerts are removed from the store, so they would be lost if only rendered.
+	if *dryRun {
+		return errors.New("the dead-letter store can't be replayed in the dry-run mode")
+	}
+	store, err := openDeadLetters(logger)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return errors.Wrap(err, "invalid configuration")
+	}
+	issueTracker, err := newIssueTracker(logger, cfg)
+	if err != nil {
+		return errors.Wrap(err, "invalid issue tracker configuration")
+	}
+	createIssue := func(w *alertmanager.Webhook) error {
+		return issueTracker.CreateIssue(context.Background(), w)
+	}
+	if len(ids) == 0 {
+		replayed, err := store.ReplayAll(createIssue)
+		logger.WithField("replayed", replayed).Info("replayed alerts from the dead-letter store")
+		return err
+	}
+	for _, id := range ids {
+		if err := store.Replay(id, createIssue); err != nil {
+			return errors.Wrapf(err, "failed to replay dead-letter entry %s", id)
+		}
+	}
+	return nil
+}
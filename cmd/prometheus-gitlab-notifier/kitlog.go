@@ -0,0 +1,50 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	kitlog "github.com/go-kit/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// kitLogger adapts the logrus logger to the go-kit logger used by the Prometheus libraries.
+type kitLogger struct {
+	logger log.FieldLogger
+}
+
+var _ kitlog.Logger = kitLogger{}
+
+// Log logs the key value pairs, the `msg` and `level` keys are used as the logrus message and level.
+func (l kitLogger) Log(keyvals ...interface{}) error {
+	fields := log.Fields{}
+	msg := ""
+	logLevel := log.InfoLevel
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		switch key {
+		case "msg":
+			msg = fmt.Sprint(keyvals[i+1])
+		case "level":
+			if parsed, err := log.ParseLevel(fmt.Sprint(keyvals[i+1])); err == nil {
+				logLevel = parsed
+			}
+		default:
+			fields[key] = keyvals[i+1]
+		}
+	}
+	l.logger.WithFields(fields).Log(logLevel, msg)
+	return nil
+}
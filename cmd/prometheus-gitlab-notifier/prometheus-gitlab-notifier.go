@@ -15,26 +15,36 @@ package main
 
 import (
 	"context"
-	_ "embed"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
-	"text/template"
 	"time"
 
-	"github.com/Masterminds/sprig"
 	"github.com/alecthomas/kingpin"
-	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/api"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/deadletter"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/dryrun"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/gitea"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/github"
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/gitlab"
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/handler"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/jira"
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/prober"
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/processor"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/queue"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/reloader"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/exporter-toolkit/web"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -50,16 +60,12 @@ func setupLogger(debug bool, logJSON bool) log.FieldLogger {
 	return l
 }
 
-func waitForEmptyChannel(logger log.FieldLogger, ch <-chan *alertmanager.Webhook) {
-	logger.Info("waiting for all the alerts to be processed")
-	for {
-		if len(ch) > 0 {
-			logger.WithField("queue_size", len(ch)).Info("there are still alerts in the queue, waiting for them to be processed")
-			time.Sleep(10 * time.Millisecond)
-			continue
-		}
-		break
-	}
+// waitForProcessing closes the queue and waits until the workers processed all the alerts left in it,
+// so no alert being processed is interrupted by exiting.
+func waitForProcessing(logger log.FieldLogger, q *queue.Queue, proc *processor.Processor) {
+	logger.WithField("queue_size", q.Len()).Info("waiting for all the alerts to be processed")
+	q.Close()
+	proc.Wait()
 	logger.Info("processing of the rest of alerts is done")
 }
 
@@ -71,10 +77,16 @@ func startServer(logger log.FieldLogger, r http.Handler) (*http.Server, <-chan e
 		WriteTimeout: 5 * time.Second,
 		ReadTimeout:  5 * time.Second,
 	}
+	systemdSocket := false
+	webConfig := &web.FlagConfig{
+		WebListenAddresses: &[]string{*serverAddr},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      webConfigFile,
+	}
 	go func() {
 		defer close(errCh)
-		logger.WithField("addr", "0.0.0.0:9629").Info("Starting prometheus-gitlab-notifier")
-		if err := srv.ListenAndServe(); err != nil {
+		logger.WithField("addr", *serverAddr).Info("Starting prometheus-gitlab-notifier")
+		if err := web.ListenAndServe(srv, webConfig, kitLogger{logger: logger}); err != nil {
 			if err != http.ErrServerClosed {
 				logger.WithField("err", err).Error("server failed")
 				errCh <- err
@@ -89,72 +101,319 @@ var (
 	debug                = app.Flag("debug", "Enables debug logging.").Bool()
 	logJSON              = app.Flag("log.json", "Log in JSON format").Bool()
 	serverAddr           = app.Flag("server.addr", "Allows to change the address and port at which the server will listen for incoming connections.").Default("0.0.0.0:9629").String()
+	webConfigFile        = app.Flag("web.config.file", "Path to configuration file that can enable TLS, mutual TLS or basic authentication of the HTTP server in the Prometheus exporter-toolkit format. Changes of the file and certificates are applied to new connections without restart.").Default("").String()
 	gitlabURL            = app.Flag("gitlab.url", "URL of the Gitlab API.").Default("https://gitlab.com").String()
-	gitlabTokenFile      = app.Flag("gitlab.token.file", "Path to file containing gitlab token.").Required().ExistingFile()
-	projectID            = app.Flag("project.id", "Id of project where to create the issues.").Required().Int()
+	gitlabRateLimit      = app.Flag("gitlab.rate.limit", "Maximum number of Gitlab API requests per second. If not set, the limit is given by the rate limit headers of the Gitlab.").Default("0").Float64()
+	gitlabRateBurst      = app.Flag("gitlab.rate.burst", "Maximum number of Gitlab API requests sent at once if the --gitlab.rate.limit is set.").Default("10").Int()
+	configFile           = app.Flag("config.file", "Path to YAML config file. Values set in the config file override the corresponding flags. Can be reloaded by sending SIGHUP or POST request to the /-/reload endpoint.").ExistingFile()
+	gitlabTokenFile      = app.Flag("gitlab.token.file", "Path to file containing gitlab token.").ExistingFile()
+	gitlabTokenEnv       = app.Flag("gitlab.token.env", "Name of environment variable containing gitlab token. Takes precedence over the --gitlab.token.file.").String()
+	credentialsInterval  = app.Flag("credentials.watch.interval", "How often to check the token files for changes and rebuild the issue tracker client if changed, 0 disables the watching (go duration syntax allowing 'ns', 'us' , 'ms', 's', 'm', 'h').").Default("30s").Duration()
+	webhookBearerFile    = app.Flag("webhook.auth.bearer.token.file", "Path to file containing token the webhook requests have to send in the `Authorization: Bearer <token>` header.").ExistingFile()
+	webhookBasicUsername = app.Flag("webhook.auth.basic.username", "Username the webhook requests have to send using basic authentication.").String()
+	webhookBasicPassFile = app.Flag("webhook.auth.basic.password.file", "Path to file containing password the webhook requests have to send using basic authentication.").ExistingFile()
+	webhookHMACFile      = app.Flag("webhook.auth.hmac.secret.file", "Path to file containing secret used to verify HMAC-SHA256 signature of the webhook request body.").ExistingFile()
+	webhookHMACHeader    = app.Flag("webhook.auth.hmac.header", "Header of the webhook request containing hex encoded HMAC-SHA256 signature of the body, optionally prefixed by `sha256=`.").Default(api.DefaultHMACHeader).String()
+	projectID            = app.Flag("project.id", "Id or path (`group/project`) of project where to create the issues if not overridden by the routes.").String()
 	groupInterval        = app.Flag("group.interval", "Duration how long back to check for opened issues with the same group labels to append the new alerts to (go duration syntax allowing 'ns', 'us' , 'ms', 's', 'm', 'h').").Default("1h").Duration()
 	issueLabels          = app.Flag("issue.label", "Labels to add to the created issue. (Can be passed multiple times)").Strings()
 	dynamicIssueLabels   = app.Flag("dynamic.issue.label.name", "Alert label, which is to be propagated to the resulting Gitlab issue as scoped label if present in the received alert. (Can be passed multiple times)").Strings()
+	closeOnResolve       = app.Flag("issue.close.on.resolve", "Close the matching open issues once all alerts of the group are resolved. Requires the `send_resolved` to be enabled in Alertmanager.").Bool()
+	issueAppendMode      = app.Flag("issue.append.mode", "How to append new alerts to an existing issue. `description` appends them to the issue description, `note` adds them as issue notes and `discussion` adds them as replies to a single discussion thread.").Default(config.AppendModeDescription).Enum(config.AppendModes...)
+	issueIncident        = app.Flag("issue.incident", "Create the issues as Gitlab incidents with severity based on the alert `severity` label.").Bool()
 	issueTemplatePath    = app.Flag("issue.template", "Path to the issue golang template file.").ExistingFile()
+	issueTemplateFixture = app.Flag("issue.template.fixture", "Alertmanager webhook JSON file the templates are validated with when the config is loaded, the config is refused if they fail to render. (Can be passed multiple times)").ExistingFiles()
+	issueTemplateStrict  = app.Flag("issue.template.strict", "Refuse the config if the templates fail to render with the built-in sample data, instead of only logging a warning.").Bool()
+	grafanaURL           = app.Flag("grafana.url", "Base URL of the Grafana linked from the issue templates using the `grafanaExploreURL` function.").String()
+	grafanaDatasource    = app.Flag("grafana.datasource", "UID of the Prometheus datasource queried in the Grafana linked from the issue templates, the default datasource is used if not set.").String()
+	issueTitleTemplate   = app.Flag("issue.title.template", "Golang template of the issue title. Overrides the `title` template defined in the issue template. If neither is set, defaults to \"Firing alert `<alertname>`\".").String()
 	queueSizeLimit       = app.Flag("queue.size.limit", "Limit of the alert queue size.").Default("100").Int()
-	retryBackoff         = app.Flag("retry.backoff", "Duration how long to wait till next retry (go duration syntax allowing 'ns', 'us' , 'ms', 's', 'm', 'h').").Default("5m").Duration()
+	processorWorkers     = app.Flag("processor.workers", "Number of workers processing the alerts in parallel. Alerts of the same group are always processed by the same worker one by one.").Default("4").Int()
+	queueDir             = app.Flag("queue.dir", "Directory where to persist the queued alerts, so they survive restart. If not set, the queue is kept in memory only.").String()
+	retryBackoff         = app.Flag("retry.backoff", "Duration how long to wait till first retry, doubled with each following retry (go duration syntax allowing 'ns', 'us' , 'ms', 's', 'm', 'h').").Default("5m").Duration()
+	retryMaxBackoff      = app.Flag("retry.max.backoff", "Maximum duration how long to wait till next retry (go duration syntax allowing 'ns', 'us' , 'ms', 's', 'm', 'h').").Default("1h").Duration()
 	retryLimit           = app.Flag("retry.limit", "Maximum number of retries for single alert. If exceeded it's thrown away.").Default("5").Int()
 	gracefulShutdownWait = app.Flag("graceful.shutdown.wait.duration", "Duration how long to wait on graceful shutdown marked as not ready (go duration syntax allowing 'ns', 'us' , 'ms', 's', 'm', 'h').").Default("30s").Duration()
+	deadLetterDir        = app.Flag("dead.letter.dir", "Directory where to store the alerts dropped after failing to be processed, so they can be replayed later. If not set, the dropped alerts are lost.").String()
+	dryRun               = app.Flag("dry-run", "Only render the issues from the received alerts and write them to the --dry-run.output without calling the issue tracker. The issue tracker credentials and project are not required.").Bool()
+	dryRunOutput         = app.Flag("dry-run.output", "Where to write the issues rendered in the dry-run mode. `log` logs them and `file` writes each of them as JSON file to the --dry-run.output.dir.").Default(dryrun.OutputLog).Enum(dryrun.Outputs...)
+	dryRunOutputDir      = app.Flag("dry-run.output.dir", "Directory where to write the issues rendered in the dry-run mode if the --dry-run.output is `file`.").String()
+	tracingEndpoint      = app.Flag("tracing.otlp.endpoint", "Address (`host:port`) of the OTLP receiver to export the traces to. If not set, the tracing is disabled.").String()
+	tracingProtocol      = app.Flag("tracing.otlp.protocol", "Protocol used to export the traces over OTLP, one of `grpc` or `http`.").Default(tracing.ProtocolGRPC).Enum(tracing.ProtocolGRPC, tracing.ProtocolHTTP)
+	tracingInsecure      = app.Flag("tracing.otlp.insecure", "Disable TLS of the connection to the OTLP receiver.").Bool()
+	tracingSamplingRatio = app.Flag("tracing.sampling.ratio", "Ratio of the traces to be sampled in range 0 to 1.").Default("1").Float64()
+
+	serveCmd             = app.Command("serve", "Start the server creating issues from the received alerts.").Default()
+	deadLettersCmd       = app.Command("dead-letters", "Manage the alerts in the dead-letter store given by --dead.letter.dir.")
+	deadLettersListCmd   = deadLettersCmd.Command("list", "List the alerts in the dead-letter store.")
+	deadLettersReplayCmd = deadLettersCmd.Command("replay", "Create issues from the alerts in the dead-letter store using the current configuration and remove them from the store.")
+	deadLettersReplayIDs = deadLettersReplayCmd.Arg("id", "IDs of the alerts to replay, all of them if not set.").Strings()
+	renderCmd            = app.Command("render", "Print the issue rendered from the Alertmanager webhook JSON file using the current configuration, without calling the issue tracker.")
+	renderAlertFile      = renderCmd.Arg("alert", "Path to the file with the Alertmanager webhook JSON.").Required().ExistingFile()
 )
 
-//go:embed default_issue.tmpl
-var defaultIssueTemplate []byte
+// absPath returns absolute version of the path given by flag, so it is not resolved relative to the config file.
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// loadConfig builds the config from the flags and overrides it with the config file if given.
+func loadConfig(logger log.FieldLogger) (*config.Config, error) {
+	// Settings given by flags are used as defaults and the root route.
+	cfg := &config.Config{
+		Tracker: config.TrackerGitlab,
+		Github: config.GithubConfig{
+			URL: "https://api.github.com",
+		},
+		Jira: config.JiraConfig{
+			IssueType:       "Task",
+			CloseTransition: "Done",
+		},
+		Gitlab: config.GitlabConfig{
+			URL:       *gitlabURL,
+			TokenFile: absPath(*gitlabTokenFile),
+			TokenEnv:  *gitlabTokenEnv,
+			RateLimit: config.RateLimitConfig{
+				RequestsPerSecond: *gitlabRateLimit,
+				Burst:             *gitlabRateBurst,
+			},
+		},
+		Route: &routing.Route{
+			Project:                *projectID,
+			IssueLabels:            *issueLabels,
+			DynamicIssueLabels:     *dynamicIssueLabels,
+			IssueTemplateFile:      absPath(*issueTemplatePath),
+			IssueTitleTemplateText: *issueTitleTemplate,
+			GroupInterval:          model.Duration(*groupInterval),
+		},
+		CloseOnResolve:  *closeOnResolve,
+		IssueAppendMode: *issueAppendMode,
+		Assignees: config.AssigneesConfig{
+			Annotation: config.DefaultAssigneeAnnotation,
+		},
+		SeverityLabel: config.DefaultSeverityLabel,
+		Incident: config.IncidentConfig{
+			Enabled:        *issueIncident,
+			TimelineEvents: true,
+		},
+		Retry: config.RetryConfig{
+			Limit:      *retryLimit,
+			Backoff:    model.Duration(*retryBackoff),
+			MaxBackoff: model.Duration(*retryMaxBackoff),
+		},
+		Grafana: config.GrafanaConfig{
+			URL:        *grafanaURL,
+			Datasource: *grafanaDatasource,
+		},
+		TemplateValidation: config.TemplateValidationConfig{
+			Strict: *issueTemplateStrict,
+		},
+		DryRun: *dryRun,
+	}
+	for _, fixture := range *issueTemplateFixture {
+		cfg.TemplateValidation.Fixtures = append(cfg.TemplateValidation.Fixtures, absPath(fixture))
+	}
+	var err error
+	if *configFile == "" {
+		err = cfg.Init(".")
+	} else {
+		err = config.LoadFile(*configFile, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TemplateWarning != nil {
+		logger.WithField("err", cfg.TemplateWarning).Warn("the templates fail to render with the built-in sample data and may fail to render the alerts, check the template or validate it with --issue.template.fixture instead")
+	}
+	return cfg, nil
+}
+
+// newDryRun returns issue tracker only rendering the issues to the output given by the flags.
+func newDryRun(logger log.FieldLogger, cfg *config.Config) (tracker.IssueTracker, error) {
+	dryRunLogger := logger.WithField("component", "dryrun")
+	output := dryrun.NewLogOutput(dryRunLogger)
+	if *dryRunOutput == dryrun.OutputFile {
+		var err error
+		output, err = dryrun.NewFileOutput(*dryRunOutputDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid dry-run output")
+		}
+	}
+	return dryrun.New(dryRunLogger, cfg, output), nil
+}
+
+// applyConfig loads the config and applies it to the processor, so all the following alerts are processed with it.
+// The credential files of the config are then watched for changes by the watcher.
+func applyConfig(logger log.FieldLogger, proc *processor.Processor, watcher *reloader.FileWatcher) error {
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		logger.WithField("err", err).Error("invalid configuration")
+		return err
+	}
+	issueTracker, err := newIssueTracker(logger, cfg)
+	if err != nil {
+		logger.WithFields(log.Fields{"err": err, "tracker": cfg.Tracker}).Error("invalid issue tracker configuration")
+		return err
+	}
+	proc.ApplyConfig(issueTracker, cfg.Retry)
+	watcher.SetFiles(cfg.CredentialFiles()...)
+	return nil
+}
+
+// newIssueTracker returns the issue tracker selected in the config.
+func newIssueTracker(logger log.FieldLogger, cfg *config.Config) (tracker.IssueTracker, error) {
+	if cfg.DryRun {
+		return newDryRun(logger, cfg)
+	}
+	tokenFiles := map[string]string{
+		config.TrackerGitlab: cfg.Gitlab.TokenFile,
+		config.TrackerGithub: cfg.Github.TokenFile,
+		config.TrackerGitea:  cfg.Gitea.TokenFile,
+		config.TrackerJira:   cfg.Jira.TokenFile,
+	}
+	var token string
+	switch {
+	case cfg.Tracker == config.TrackerGitlab && cfg.Gitlab.OAuth != nil:
+		// The tokens are obtained by the Gitlab client using the OAuth client credentials.
+	case cfg.Tracker == config.TrackerGitlab && cfg.Gitlab.TokenEnv != "":
+		token = strings.TrimSpace(os.Getenv(cfg.Gitlab.TokenEnv))
+		if token == "" {
+			return nil, errors.Errorf("the environment variable %s with the token is not set", cfg.Gitlab.TokenEnv)
+		}
+	default:
+		tokenData, err := os.ReadFile(tokenFiles[cfg.Tracker])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read token file")
+		}
+		token = strings.TrimSpace(string(tokenData))
+	}
+	trackerLogger := logger.WithField("component", cfg.Tracker)
+	switch cfg.Tracker {
+	case config.TrackerGithub:
+		return tracker.NewSimple(trackerLogger, github.New(cfg.Github, token), cfg), nil
+	case config.TrackerGitea:
+		return tracker.NewSimple(trackerLogger, gitea.New(cfg.Gitea, token), cfg), nil
+	case config.TrackerJira:
+		return tracker.NewSimple(trackerLogger, jira.New(cfg.Jira, token), cfg), nil
+	default:
+		return gitlab.New(trackerLogger, token, cfg)
+	}
+}
 
 func main() {
 	var err error
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 
 	// Initiate logging.
 	logger := setupLogger(*debug, *logJSON)
 
-	tpl := template.New("base").Funcs(template.FuncMap(sprig.FuncMap()))
-
-	templateContents := defaultIssueTemplate
-	if *issueTemplatePath != "" {
-		templateContents, err = os.ReadFile(*issueTemplatePath)
-		if err != nil {
-			logger.WithFields(log.Fields{"err": err, "file": issueTemplatePath}).Error("failed to read template file")
+	switch command {
+	case deadLettersListCmd.FullCommand():
+		if err := listDeadLetters(logger, os.Stdout); err != nil {
+			logger.WithField("err", err).Error("failed to list dead-letter store")
 			os.Exit(1)
 		}
+		return
+	case deadLettersReplayCmd.FullCommand():
+		if err := replayDeadLetters(logger, *deadLettersReplayIDs); err != nil {
+			logger.WithField("err", err).Error("failed to replay dead-letter store")
+			os.Exit(1)
+		}
+		return
+	case renderCmd.FullCommand():
+		if err := renderAlert(logger, *renderAlertFile, os.Stdout); err != nil {
+			logger.WithField("err", err).Error("failed to render the alert")
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Initiate Gitlab client.
-	gitlabIssueTextTemplate, err := tpl.Parse(string(templateContents))
-	if err != nil {
-		logger.WithFields(log.Fields{"err": err, "file": issueTemplatePath}).Error("invalid gitlab issue template")
+	// Check the TLS configuration of the server is valid, so it does not fail on first connection.
+	if err := web.Validate(*webConfigFile); err != nil {
+		logger.WithFields(log.Fields{"err": err, "file": *webConfigFile}).Error("invalid web config file")
 		os.Exit(1)
 	}
-	token, err := os.ReadFile(*gitlabTokenFile)
-	if err != nil {
-		logger.WithFields(log.Fields{"err": err, "file": gitlabTokenFile}).Error("failed to read token file")
+
+	// Check the webhook authentication is configured correctly.
+	webhookAuth := api.AuthConfig{
+		BearerTokenFile:   *webhookBearerFile,
+		BasicUsername:     *webhookBasicUsername,
+		BasicPasswordFile: *webhookBasicPassFile,
+		HMACSecretFile:    *webhookHMACFile,
+		HMACHeader:        *webhookHMACHeader,
+	}
+	if err := webhookAuth.Validate(); err != nil {
+		logger.WithField("err", err).Error("invalid webhook authentication configuration")
 		os.Exit(1)
 	}
-	g, err := gitlab.New(
-		logger.WithField("component", "gitlab"),
-		*gitlabURL,
-		strings.TrimSpace(string(token)),
-		*projectID,
-		gitlabIssueTextTemplate,
-		issueLabels,
-		dynamicIssueLabels,
-		groupInterval,
-	)
+
+	// Initiate export of the traces, so the alerts can be traced from receiving the webhook to the issue tracker API calls.
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Endpoint:      *tracingEndpoint,
+		Protocol:      *tracingProtocol,
+		Insecure:      *tracingInsecure,
+		SamplingRatio: *tracingSamplingRatio,
+	})
 	if err != nil {
-		logger.WithField("err", err).Error("invalid gitlab configuration")
+		logger.WithField("err", err).Error("failed to initialize tracing")
 		os.Exit(1)
 	}
+	// Flush the remaining spans, has to be called explicitly before exiting.
+	flushTracing := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.WithField("err", err).Warn("failed to flush the traces")
+		}
+	}
+
+	// Initiate the dead-letter store for the dropped alerts.
+	var deadLetters *deadletter.Store
+	if *deadLetterDir != "" {
+		deadLetters, err = deadletter.New(logger.WithField("component", "deadletter"), *deadLetterDir)
+		if err != nil {
+			logger.WithFields(log.Fields{"err": err, "dir": *deadLetterDir}).Error("failed to initialize dead-letter store")
+			os.Exit(1)
+		}
+	}
+
+	// Watch the credential files, so the issue tracker client is rebuilt with the new credentials once they are rotated.
+	var configReloader *reloader.Reloader
+	credentialsWatcher := reloader.NewFileWatcher(logger.WithField("component", "watcher"), *credentialsInterval, func() {
+		_ = configReloader.Reload()
+	})
+
+	// Initiate the processor with the issue tracker client.
+	proc := processor.New(logger.WithField("component", "processor"), deadLetters)
+	if err := applyConfig(logger, proc, credentialsWatcher); err != nil {
+		os.Exit(1)
+	}
+	if *dryRun {
+		logger.WithField("output", *dryRunOutput).Warn("running in dry-run mode, the issues are only rendered and the issue tracker is not called")
+	}
+
+	// Initiate the alert queue.
+	alertQueue := queue.NewInMemory(logger.WithField("component", "queue"), *queueSizeLimit)
+	if *queueDir != "" {
+		alertQueue, err = queue.NewDurable(logger.WithField("component", "queue"), *queueSizeLimit, *queueDir)
+		if err != nil {
+			logger.WithFields(log.Fields{"err": err, "dir": *queueDir}).Error("failed to initialize durable queue")
+			os.Exit(1)
+		}
+	}
+	metrics.Register(queue.NewCollector(alertQueue))
 
 	// Start processing all incoming alerts.
-	alertChan := make(chan *alertmanager.Webhook, *queueSizeLimit)
-	proc := processor.New(logger.WithField("component", "processor"))
 	processCtx, processCancelFunc := context.WithCancel(context.Background())
 	defer processCancelFunc()
-	proc.Process(processCtx, g, alertChan, *retryLimit, *retryBackoff)
+	proc.Process(processCtx, alertQueue, *processorWorkers)
 
 	// Setup routing for HTTP server.
 	r := mux.NewRouter()
@@ -162,13 +421,36 @@ func main() {
 	webhookAPI := api.NewInRouter(
 		logger.WithField("component", "api"),
 		r.PathPrefix("/api").Subrouter(),
-		alertChan,
+		alertQueue,
+		webhookAuth,
 	)
 	// Initialize prober providing readiness and liveness checks.
 	readinessProber := prober.NewInRouter(
 		logger.WithField("component", "prober"),
 		r.PathPrefix("/").Subrouter(),
 	)
+	readinessProber.RegisterCheck("issue_tracker", proc.CheckIssueTracker)
+	readinessProber.RegisterCheck("queue", func() error {
+		if alertQueue.Len() >= alertQueue.Cap() {
+			return errors.Errorf("queue is full with %d alerts", alertQueue.Len())
+		}
+		return nil
+	})
+	readinessProber.RegisterCheck("processor", proc.CheckRunning)
+	// The admin endpoints are authenticated the same way as the webhook since they expose the alerts and change the configuration.
+	adminRouter := r.PathPrefix("/").Subrouter()
+	adminRouter.Use(webhookAuth.Middleware(logger.WithField("component", "admin")))
+	// Initialize reloader allowing to reload the configuration over HTTP.
+	configReloader = reloader.NewInRouter(
+		logger.WithField("component", "reloader"),
+		adminRouter,
+		func() error { return applyConfig(logger, proc, credentialsWatcher) },
+	)
+	go credentialsWatcher.Run(processCtx)
+	// Initialize admin endpoints listing and replaying the dropped alerts.
+	if deadLetters != nil {
+		deadLetters.HandleInRouter(adminRouter, alertQueue)
+	}
 	// Initialize metrics handler to serve Prometheus metrics.
 	metrics.HandleInRouter(r)
 
@@ -179,14 +461,22 @@ func main() {
 	gracefulStop := make(chan os.Signal, 2)
 	signal.Notify(gracefulStop, syscall.SIGTERM)
 	signal.Notify(gracefulStop, syscall.SIGINT)
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
 
-	// It the server fails or we receive signal to gracefully shut down we wait till the alert queue is processed(empty).
+	// It the server fails or we receive signal to gracefully shut down we wait till the alert queue is processed(empty) and the workers are done.
 	for {
 		select {
 		case <-serverErrorChan:
 			// If server failed just wait for all the alerts to be processed.
-			waitForEmptyChannel(logger, alertChan)
+			webhookAPI.Close()
+			waitForProcessing(logger, alertQueue, proc)
+			flushTracing()
 			os.Exit(1)
+		case <-reloadSignal:
+			// The queue is kept as is, so no alerts are lost during the reload.
+			// The reload is done in background, so it does not block handling of the other signals, the reloads are serialized by the reloader.
+			go func() { _ = configReloader.Reload() }()
 		case sig := <-gracefulStop:
 			logger.WithField("signal", sig).Info("received system signal for graceful shutdown")
 			// Mark server as not ready so no new connections will come.
@@ -197,7 +487,8 @@ func main() {
 			// Stop receiving new alerts.
 			webhookAPI.Close()
 			// Wait for all enqueued alerts to be processed.
-			waitForEmptyChannel(logger, alertChan)
+			waitForProcessing(logger, alertQueue, proc)
+			flushTracing()
 			os.Exit(0)
 		}
 	}
@@ -0,0 +1,64 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/dryrun"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	log "github.com/sirupsen/logrus"
+)
+
+// renderAlert prints the issue rendered from the Alertmanager webhook in the given file using the current configuration.
+func renderAlert(logger log.FieldLogger, path string, out io.Writer) error {
+	// Only the rendering is done, so the issue tracker credentials are not required.
+	*dryRun = true
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		return errors.Wrap(err, "invalid configuration")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the alert file")
+	}
+	var message webhook.Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return errors.Wrap(err, "invalid webhook format of the alert file")
+	}
+	if message.Data == nil {
+		return errors.New("invalid webhook format of the alert file, it contains no alert data")
+	}
+	issue, err := dryrun.Render(logger, cfg.Route, cfg.CloseOnResolve, alertmanager.NewWebhookFromAlertmanagerMessage(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to render the issue")
+	}
+	fmt.Fprintf(out, "Action:          %s\n", issue.Action)
+	if issue.Close {
+		fmt.Fprintln(out, "Close:           true")
+	}
+	fmt.Fprintf(out, "Project:         %s\n", issue.Project)
+	fmt.Fprintf(out, "Title:           %s\n", issue.Title)
+	fmt.Fprintf(out, "Static labels:   %s\n", strings.Join(issue.StaticLabels, ", "))
+	fmt.Fprintf(out, "Grouping labels: %s\n", strings.Join(issue.GroupingLabels, ", "))
+	fmt.Fprintf(out, "Dynamic labels:  %s\n", strings.Join(issue.DynamicLabels, ", "))
+	fmt.Fprintf(out, "\n%s\n", issue.Description)
+	return nil
+}
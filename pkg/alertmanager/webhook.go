@@ -15,23 +15,44 @@ package alertmanager
 
 import (
 	"sync"
+	"time"
 
 	"github.com/prometheus/alertmanager/notify/webhook"
 )
 
 // NewWebhookFromAlertmanagerMessage returns new Webhook wrapping the original Alertmanager webhook.message.
 func NewWebhookFromAlertmanagerMessage(message webhook.Message) *Webhook {
+	now := time.Now()
 	return &Webhook{
 		Message:    message,
+		ReceivedAt: now,
+		QueuedAt:   now,
 		retryCount: 0,
 	}
 }
 
+// NewWebhookWithRetryCount returns new Webhook wrapping the original Alertmanager webhook.message received at the given time
+// with already given number of retries.
+func NewWebhookWithRetryCount(message webhook.Message, receivedAt time.Time, retryCount int) *Webhook {
+	return &Webhook{
+		Message:    message,
+		ReceivedAt: receivedAt,
+		QueuedAt:   receivedAt,
+		retryCount: retryCount,
+	}
+}
+
 // Webhook is wrapper for the Alertmanager webhook.message adding retry counter.
 type Webhook struct {
 	webhook.Message
-	retryCount int
-	retryMtx   sync.RWMutex
+	// ReceivedAt is time the webhook was received from the Alertmanager.
+	ReceivedAt time.Time
+	// QueuedAt is time the webhook was added to the queue, for the retried webhooks the time it is added back after the backoff.
+	QueuedAt time.Time
+	// TraceContext propagates the trace of receiving the webhook to its processing.
+	TraceContext map[string]string
+	retryCount   int
+	retryMtx     sync.RWMutex
 }
 
 // Retry increments number of retries for the Webhook.
@@ -15,23 +15,34 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"sync"
 
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/queue"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/alertmanager/notify/webhook"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// maxBodySize limits size of the request body read to memory, the Alertmanager webhooks are usually much smaller.
+const maxBodySize = 10 << 20
+
 // NewInRouter creates new API instance which will register its handlers in the given router.
-func NewInRouter(logger log.FieldLogger, r *mux.Router, ch chan<- *alertmanager.Webhook) *API {
+// The webhook requests are authenticated using the given AuthConfig, if no method is configured any request is accepted.
+func NewInRouter(logger log.FieldLogger, r *mux.Router, q *queue.Queue, auth AuthConfig) *API {
 	api := &API{
 		logger:        logger,
-		alertChan:     ch,
+		alertQueue:    q,
+		auth:          auth,
 		receiveAlerts: true,
 	}
 	api.registerHandlers(r)
@@ -41,7 +52,8 @@ func NewInRouter(logger log.FieldLogger, r *mux.Router, ch chan<- *alertmanager.
 // API defines handler functions for receiving Alertmanager endpoints.
 type API struct {
 	logger           log.FieldLogger
-	alertChan        chan<- *alertmanager.Webhook
+	alertQueue       *queue.Queue
+	auth             AuthConfig
 	receiveAlerts    bool
 	receiveAlertsMtx sync.RWMutex
 }
@@ -51,31 +63,68 @@ func (a *API) registerHandlers(router *mux.Router) {
 }
 
 func (a *API) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(tracing.ExtractHTTP(r), "webhookHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	logger := tracing.Logger(ctx, a.logger)
 	if !a.canReceiveAlerts() {
-		http.Error(w, "Server is not receiving new alerts.", http.StatusServiceUnavailable)
+		httpError(w, span, "Server is not receiving new alerts.", http.StatusServiceUnavailable)
+		return
+	}
+	body, ok := a.auth.authorize(logger, w, r, span)
+	if !ok {
 		return
 	}
 	var message webhook.Message
-	err := json.NewDecoder(r.Body).Decode(&message)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid incomming webhook format. Failed with error: %s", err), http.StatusBadRequest)
+	if err := json.Unmarshal(body, &message); err != nil {
+		httpError(w, span, fmt.Sprintf("Invalid incomming webhook format. Failed with error: %s", err), http.StatusBadRequest)
+		return
+	}
+	if message.Data == nil {
+		httpError(w, span, "Invalid incomming webhook format. The webhook contains no alert data.", http.StatusBadRequest)
 		return
 	}
 
-	// Push the message to channel
-	a.alertChan <- alertmanager.NewWebhookFromAlertmanagerMessage(message)
-	a.logger.WithField("group_key", message.GroupKey).Debug("enqueued alert for processing")
+	// Push the message to queue, the trace is continued once the alert is processed.
+	alert := alertmanager.NewWebhookFromAlertmanagerMessage(message)
+	alert.TraceContext = tracing.Inject(ctx)
+	span.SetAttributes(attribute.String("alert_grouping_key", message.GroupKey))
+	if err := a.alertQueue.Push(alert); err != nil {
+		httpError(w, span, fmt.Sprintf("Failed to enqueue the alert with error: %s", err), http.StatusServiceUnavailable)
+		return
+	}
+	logger.WithField("group_key", message.GroupKey).Debug("enqueued alert for processing")
 
 	w.WriteHeader(http.StatusOK)
 	_, _ = io.WriteString(w, `Ok, Alert enqueued.`)
 }
 
+// readBody reads the request body up to the maxBodySize and replies to the request with the error if it fails.
+func readBody(w http.ResponseWriter, r *http.Request, span trace.Span) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			httpError(w, span, fmt.Sprintf("Request body exceeds the limit of %d bytes.", maxBodySize), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		httpError(w, span, fmt.Sprintf("Failed to read request body: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// httpError replies to the request with the error and marks the span of the request as failed.
+func httpError(w http.ResponseWriter, span trace.Span, msg string, code int) {
+	span.SetStatus(codes.Error, msg)
+	http.Error(w, msg, code)
+}
+
 // Close disabled receiving of new alerts in the API used mainly for graceful shutdown.
 func (a *API) Close() {
 	a.receiveAlertsMtx.Lock()
 	defer a.receiveAlertsMtx.Unlock()
 	a.receiveAlerts = false
-	close(a.alertChan)
+	a.alertQueue.Close()
 }
 
 func (a *API) canReceiveAlerts() bool {
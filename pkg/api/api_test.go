@@ -0,0 +1,56 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/queue"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		queued int
+	}{
+		{name: "valid webhook", body: `{"version":"4","groupKey":"a","status":"firing","alerts":[]}`, status: http.StatusOK, queued: 1},
+		{name: "invalid JSON", body: `{`, status: http.StatusBadRequest},
+		{name: "webhook without data", body: `{"version":"4"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New()
+			logger.Out = io.Discard
+			q := queue.NewInMemory(logger, 1)
+			r := mux.NewRouter()
+			NewInRouter(logger, r, q, AuthConfig{})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/alertmanager", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if q.Len() != tt.queued {
+				t.Fatalf("expected %d queued alerts, got %d", tt.queued, q.Len())
+			}
+		})
+	}
+}
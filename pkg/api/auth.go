@@ -0,0 +1,189 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultHMACHeader is the default request header with the HMAC signature of the request body.
+const DefaultHMACHeader = "X-Signature"
+
+var authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "prometheus_gitlab_notifier_webhook_auth_failures_total",
+	Help: "Count of webhook requests which failed to authenticate by the reason.",
+}, []string{"reason"})
+
+func init() {
+	metrics.Register(authFailures)
+}
+
+// AuthConfig configures authentication of the webhook requests. All the configured methods have to succeed.
+// The credentials are read from the files on each request, so they can be rotated without restart.
+type AuthConfig struct {
+	// BearerTokenFile is file with token expected in the `Authorization: Bearer <token>` header.
+	BearerTokenFile string
+	// BasicUsername and BasicPasswordFile are the expected basic authentication credentials.
+	BasicUsername     string
+	BasicPasswordFile string
+	// HMACSecretFile is file with secret used to verify HMAC-SHA256 signature of the request body given in the HMACHeader.
+	HMACSecretFile string
+	HMACHeader     string
+}
+
+// Validate checks the authentication config is consistent.
+func (c AuthConfig) Validate() error {
+	if c.BearerTokenFile != "" && (c.BasicUsername != "" || c.BasicPasswordFile != "") {
+		return errors.New("bearer token and basic authentication can't be used at once since both use the Authorization header")
+	}
+	if (c.BasicUsername == "") != (c.BasicPasswordFile == "") {
+		return errors.New("both basic authentication username and password file have to be set")
+	}
+	if c.HMACSecretFile != "" && c.HMACHeader == "" {
+		return errors.New("the HMAC signature header has to be set")
+	}
+	return nil
+}
+
+// errAuthFailed is returned if the request credentials are invalid, other errors mean the credentials could not be verified.
+var errAuthFailed = errors.New("authentication failed")
+
+// readSecretFile reads the secret from the file, empty secret is an error since it would match any empty credentials.
+func readSecretFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+func secureCompare(given string, expected []byte) bool {
+	return subtle.ConstantTimeCompare([]byte(given), expected) == 1
+}
+
+// authenticateHeaders checks the request credentials given in the headers and returns reason of the failure if any.
+// Unlike the signature it does not need the body, so it is checked before reading it.
+func (c AuthConfig) authenticateHeaders(r *http.Request) (string, error) {
+	if c.BearerTokenFile != "" {
+		token, err := readSecretFile(c.BearerTokenFile)
+		if err != nil {
+			return "bearer", err
+		}
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") || !secureCompare(strings.TrimPrefix(header, "Bearer "), token) {
+			return "bearer", errAuthFailed
+		}
+	}
+	if c.BasicUsername != "" {
+		password, err := readSecretFile(c.BasicPasswordFile)
+		if err != nil {
+			return "basic", err
+		}
+		username, givenPassword, ok := r.BasicAuth()
+		// Evaluate both to not leak which one is wrong by timing.
+		usernameOk := secureCompare(username, []byte(c.BasicUsername))
+		passwordOk := secureCompare(givenPassword, password)
+		if !ok || !usernameOk || !passwordOk {
+			return "basic", errAuthFailed
+		}
+	}
+	return "", nil
+}
+
+// verifySignature checks the HMAC signature of the request body and returns reason of the failure if any.
+func (c AuthConfig) verifySignature(r *http.Request, body []byte) (string, error) {
+	if c.HMACSecretFile == "" {
+		return "", nil
+	}
+	secret, err := readSecretFile(c.HMACSecretFile)
+	if err != nil {
+		return "hmac", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	given := strings.ToLower(strings.TrimPrefix(r.Header.Get(c.HMACHeader), "sha256="))
+	if !secureCompare(given, []byte(expected)) {
+		return "hmac", errAuthFailed
+	}
+	return "", nil
+}
+
+// authorize authenticates the request by its headers, reads the body and verifies its signature.
+// Replies to the request with the error and returns false if any of it fails.
+func (c AuthConfig) authorize(logger log.FieldLogger, w http.ResponseWriter, r *http.Request, span trace.Span) ([]byte, bool) {
+	if reason, err := c.authenticateHeaders(r); err != nil {
+		c.reject(logger, w, r, span, reason, err)
+		return nil, false
+	}
+	body, ok := readBody(w, r, span)
+	if !ok {
+		return nil, false
+	}
+	if reason, err := c.verifySignature(r, body); err != nil {
+		c.reject(logger, w, r, span, reason, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// reject replies to the request which failed to authenticate for the given reason.
+func (c AuthConfig) reject(logger log.FieldLogger, w http.ResponseWriter, r *http.Request, span trace.Span, reason string, err error) {
+	authFailures.WithLabelValues(reason).Inc()
+	if !errors.Is(err, errAuthFailed) {
+		metrics.ReportError("FailedToReadWebhookCredentials", "")
+		logger.WithFields(log.Fields{"err": err, "method": reason}).Error("failed to read webhook credentials")
+		httpError(w, span, "Failed to verify credentials.", http.StatusInternalServerError)
+		return
+	}
+	logger.WithFields(log.Fields{"remote_addr": r.RemoteAddr, "method": reason, "path": r.URL.Path}).Warn("request failed to authenticate")
+	if reason == "basic" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="prometheus-gitlab-notifier"`)
+	}
+	httpError(w, span, "Unauthorized.", http.StatusUnauthorized)
+}
+
+// Middleware returns middleware authenticating the requests the same way as the webhook requests, used to protect the admin endpoints.
+func (c AuthConfig) Middleware(logger log.FieldLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := c.authorize(logger, w, r, trace.SpanFromContext(r.Context()))
+			if !ok {
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func secretFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuthenticateHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		secret        string
+		authorization string
+		failed        bool
+		credentialErr bool
+	}{
+		{name: "valid token", secret: "token\n", authorization: "Bearer token"},
+		{name: "invalid token", secret: "token", authorization: "Bearer other", failed: true},
+		{name: "missing header", secret: "token", failed: true},
+		{name: "empty secret", secret: "", authorization: "Bearer ", credentialErr: true},
+		{name: "whitespace secret", secret: " \n", authorization: "Bearer ", credentialErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := AuthConfig{BearerTokenFile: secretFile(t, tt.secret)}
+			r := httptest.NewRequest(http.MethodPost, "/alertmanager", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			_, err := c.authenticateHeaders(r)
+			switch {
+			case tt.credentialErr:
+				if err == nil || errors.Is(err, errAuthFailed) {
+					t.Fatalf("expected credential error, got %v", err)
+				}
+			case tt.failed:
+				if !errors.Is(err, errAuthFailed) {
+					t.Fatalf("expected authentication failure, got %v", err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	// HMAC-SHA256 of the body `{}` with the secret `secret`.
+	const signature = "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+	tests := []struct {
+		name          string
+		secret        string
+		signature     string
+		failed        bool
+		credentialErr bool
+	}{
+		{name: "valid signature", secret: "secret\n", signature: signature},
+		{name: "invalid signature", secret: "secret", signature: "sha256=00", failed: true},
+		{name: "missing signature", secret: "secret", failed: true},
+		{name: "empty secret", secret: "\n", signature: signature, credentialErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := AuthConfig{HMACSecretFile: secretFile(t, tt.secret), HMACHeader: DefaultHMACHeader}
+			r := httptest.NewRequest(http.MethodPost, "/alertmanager", nil)
+			r.Header.Set(DefaultHMACHeader, tt.signature)
+			_, err := c.verifySignature(r, []byte("{}"))
+			switch {
+			case tt.credentialErr:
+				if err == nil || errors.Is(err, errAuthFailed) {
+					t.Fatalf("expected credential error, got %v", err)
+				}
+			case tt.failed:
+				if !errors.Is(err, errAuthFailed) {
+					t.Fatalf("expected authentication failure, got %v", err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
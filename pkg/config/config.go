@@ -0,0 +1,426 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/issuetemplate"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Supported issue tracking systems.
+const (
+	TrackerGitlab = "gitlab"
+	TrackerGithub = "github"
+	TrackerGitea  = "gitea"
+	TrackerJira   = "jira"
+)
+
+// Trackers lists all the supported issue tracking systems.
+var Trackers = []string{TrackerGitlab, TrackerGithub, TrackerGitea, TrackerJira}
+
+// Modes of appending the new alerts to an existing issue.
+const (
+	// AppendModeDescription appends the rendered alert to the issue description.
+	AppendModeDescription = "description"
+	// AppendModeNote adds the rendered alert as a new issue note (comment).
+	AppendModeNote = "note"
+	// AppendModeDiscussion adds the rendered alert as a reply to a single discussion thread of the issue.
+	AppendModeDiscussion = "discussion"
+)
+
+// DefaultAssigneeAnnotation is the default name of the alert annotation containing the issue assignees.
+const DefaultAssigneeAnnotation = "gitlab_assignee"
+
+// DefaultSeverityLabel is the default name of the alert label containing severity of the alert.
+const DefaultSeverityLabel = "severity"
+
+// AppendModes lists all the supported modes of appending alerts to an existing issue.
+var AppendModes = []string{AppendModeDescription, AppendModeNote, AppendModeDiscussion}
+
+// Config holds all the configuration of the notifier which can be reloaded at runtime.
+type Config struct {
+	// Tracker is the issue tracking system to create the issues in, see Trackers.
+	Tracker         string                    `yaml:"tracker"`
+	Github          GithubConfig              `yaml:"github"`
+	Gitea           GiteaConfig               `yaml:"gitea"`
+	Jira            JiraConfig                `yaml:"jira"`
+	Gitlab          GitlabConfig              `yaml:"gitlab"`
+	Route           *routing.Route            `yaml:"route"`
+	CloseOnResolve  bool                      `yaml:"close_on_resolve"`
+	IssueAppendMode string                    `yaml:"issue_append_mode"`
+	Assignees       AssigneesConfig           `yaml:"assignees"`
+	SeverityLabel   string                    `yaml:"severity_label"`
+	Severities      map[string]SeverityConfig `yaml:"severities"`
+	Incident        IncidentConfig            `yaml:"incident"`
+	Retry           RetryConfig               `yaml:"retry"`
+	Grafana         GrafanaConfig             `yaml:"grafana"`
+	// TemplateValidation configures validation of the templates when the config is loaded.
+	TemplateValidation TemplateValidationConfig `yaml:"template_validation"`
+	// TemplateWarning is error of the templates rendered with the built-in sample data if the validation is not strict.
+	TemplateWarning error `yaml:"-"`
+	// DryRun renders the issues without calling the issue tracker, so its settings are not required.
+	// It can't be set in the config file, so the config file used in production can be tested as is.
+	DryRun bool `yaml:"-"`
+}
+
+// GitlabConfig configures the Gitlab API client.
+// The token is taken from the first configured source in order OAuth, TokenEnv and TokenFile.
+type GitlabConfig struct {
+	URL       string `yaml:"url"`
+	TokenFile string `yaml:"token_file"`
+	// TokenEnv is name of the environment variable containing the token.
+	TokenEnv  string          `yaml:"token_env"`
+	OAuth     *OAuthConfig    `yaml:"oauth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// OAuthConfig configures OAuth client credentials flow to obtain the API tokens.
+type OAuthConfig struct {
+	ClientID         string `yaml:"client_id"`
+	ClientSecretFile string `yaml:"client_secret_file"`
+	// TokenURL defaults to the `/oauth/token` endpoint of the Gitlab.
+	TokenURL string   `yaml:"token_url"`
+	Scopes   []string `yaml:"scopes"`
+}
+
+// RateLimitConfig configures the client-side token bucket rate limiter of the API requests.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the rate of the requests, the limiter is disabled if zero.
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// Burst is the maximum number of requests sent at once.
+	Burst int `yaml:"burst"`
+}
+
+// GithubConfig configures the GitHub API client. The route project is the repository in format `owner/repo`.
+type GithubConfig struct {
+	URL       string `yaml:"url"`
+	TokenFile string `yaml:"token_file"`
+}
+
+// GiteaConfig configures the Gitea or Forgejo API client. The route project is the repository in format `owner/repo`.
+type GiteaConfig struct {
+	URL       string `yaml:"url"`
+	TokenFile string `yaml:"token_file"`
+}
+
+// JiraConfig configures the Jira API client. The route project is the Jira project key.
+type JiraConfig struct {
+	URL string `yaml:"url"`
+	// Username is used for basic authentication with the token as password (Jira Cloud), if empty the token is used as bearer token (Jira Data Center).
+	Username  string `yaml:"username"`
+	TokenFile string `yaml:"token_file"`
+	// IssueType is name of the type of the created issues.
+	IssueType string `yaml:"issue_type"`
+	// CloseTransition is name of the workflow transition used to close the issue.
+	CloseTransition string `yaml:"close_transition"`
+}
+
+// AssigneesConfig configures assigning of the created issues to Gitlab users based on the alerts.
+// The users are given as usernames or numeric user IDs.
+type AssigneesConfig struct {
+	// Labels are names of the alert labels which values are the users to assign, e.g. `owner`.
+	Labels []string `yaml:"labels"`
+	// LabelValueMapping maps label name and its value to the users to assign, e.g. `team: {database: [alice, bob]}`.
+	LabelValueMapping map[string]map[string][]string `yaml:"label_value_mapping"`
+	// Annotation is name of the alert annotation containing comma separated users to assign. Empty disables it.
+	Annotation string `yaml:"annotation"`
+}
+
+// SeverityConfig holds fields of the created issue set based on the severity of the alert.
+type SeverityConfig struct {
+	// DueIn sets the issue due date to the time of creation plus the duration.
+	DueIn  model.Duration `yaml:"due_in"`
+	Weight *int           `yaml:"weight"`
+	// Milestone is title of the project or its group milestone to set.
+	Milestone string `yaml:"milestone"`
+	// CurrentMilestone sets the currently active milestone, mutually exclusive with the Milestone.
+	CurrentMilestone bool `yaml:"current_milestone"`
+}
+
+// IncidentSeverities lists the severities of Gitlab incidents.
+var IncidentSeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "INFO", "UNKNOWN"}
+
+// DefaultIncidentSeverityMapping maps commonly used alert severities to the Gitlab incident severities.
+var DefaultIncidentSeverityMapping = map[string]string{
+	"critical": "CRITICAL",
+	"error":    "HIGH",
+	"high":     "HIGH",
+	"warning":  "MEDIUM",
+	"low":      "LOW",
+	"info":     "INFO",
+}
+
+// IncidentConfig configures creating of the issues as Gitlab incidents.
+type IncidentConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SeverityMapping maps the alert severity to the incident severity, see IncidentSeverities. Unknown severities are mapped to UNKNOWN.
+	SeverityMapping map[string]string `yaml:"severity_mapping"`
+	// TimelineEvents enables adding of the appended and resolved alerts as incident timeline events.
+	TimelineEvents bool `yaml:"timeline_events"`
+}
+
+// RetryConfig configures retrying of the alerts which failed to be processed.
+type RetryConfig struct {
+	Limit int `yaml:"limit"`
+	// Backoff is the initial backoff doubled with each retry up to the MaxBackoff.
+	Backoff    model.Duration `yaml:"backoff"`
+	MaxBackoff model.Duration `yaml:"max_backoff"`
+}
+
+// GrafanaConfig configures the Grafana linked from the issue templates using the grafanaExploreURL function.
+type GrafanaConfig struct {
+	URL string `yaml:"url"`
+	// Datasource is UID of the Prometheus datasource to query, the default datasource is used if empty.
+	Datasource string `yaml:"datasource"`
+}
+
+// TemplateValidationConfig configures validation of the templates by executing them with sample alerts,
+// accessing a missing key of the alert data is an error.
+type TemplateValidationConfig struct {
+	// Strict refuses the config if the templates access keys missing in the built-in sample data, otherwise it is only a warning,
+	// since the sample data can't contain all the labels used in the templates.
+	Strict bool `yaml:"strict"`
+	// Fixtures are paths of Alertmanager webhook JSON files the templates have to render with, otherwise the config is refused.
+	// If set, the built-in sample data is not used.
+	Fixtures []string `yaml:"fixtures"`
+}
+
+// LoadFile loads the YAML config file on top of the given config, so only the values set in the file are overridden.
+// Relative paths in the file are resolved relative to the directory of the file.
+func LoadFile(path string, cfg *Config) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(contents, cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	baseDir := filepath.Dir(path)
+	tokenFiles := []*string{&cfg.Gitlab.TokenFile, &cfg.Github.TokenFile, &cfg.Gitea.TokenFile, &cfg.Jira.TokenFile}
+	if cfg.Gitlab.OAuth != nil {
+		tokenFiles = append(tokenFiles, &cfg.Gitlab.OAuth.ClientSecretFile)
+	}
+	for i, fixture := range cfg.TemplateValidation.Fixtures {
+		if !filepath.IsAbs(fixture) {
+			cfg.TemplateValidation.Fixtures[i] = filepath.Join(baseDir, fixture)
+		}
+	}
+	for _, tokenFile := range tokenFiles {
+		if *tokenFile != "" && !filepath.IsAbs(*tokenFile) {
+			*tokenFile = filepath.Join(baseDir, *tokenFile)
+		}
+	}
+	return cfg.Init(baseDir)
+}
+
+// Init loads all the templates and validates the config. Relative paths are resolved relative to the baseDir.
+func (c *Config) Init(baseDir string) error {
+	if c.Route == nil {
+		return fmt.Errorf("the route has to be configured")
+	}
+	if c.Route.IssueTemplateFile == "" && c.Route.IssueTemplate == nil {
+		tpl, err := issuetemplate.Default(c.templateOptions())
+		if err != nil {
+			return fmt.Errorf("invalid default issue template: %w", err)
+		}
+		c.Route.IssueTemplate = tpl
+	}
+	if err := c.Route.LoadTemplates(baseDir, c.templateOptions()); err != nil {
+		return err
+	}
+	if err := c.validateTemplates(); err != nil {
+		return err
+	}
+	// The defaults can't be set before loading the config file, since strict unmarshalling refuses keys already set in the map.
+	if c.Incident.SeverityMapping == nil {
+		c.Incident.SeverityMapping = map[string]string{}
+	}
+	for severity, incidentSeverity := range DefaultIncidentSeverityMapping {
+		if _, ok := c.Incident.SeverityMapping[severity]; !ok {
+			c.Incident.SeverityMapping[severity] = incidentSeverity
+		}
+	}
+	return c.Validate()
+}
+
+// templateOptions returns configuration of the alerting functions available in the templates.
+func (c *Config) templateOptions() issuetemplate.Options {
+	return issuetemplate.Options{
+		GrafanaURL:        c.Grafana.URL,
+		GrafanaDatasource: c.Grafana.Datasource,
+	}
+}
+
+// validateTemplates executes the templates with the fixtures if given, otherwise with the built-in sample data, see TemplateValidationConfig.
+func (c *Config) validateTemplates() error {
+	c.TemplateWarning = nil
+	for _, fixture := range c.TemplateValidation.Fixtures {
+		data, err := issuetemplate.LoadFixture(fixture)
+		if err != nil {
+			return err
+		}
+		if err := c.Route.ValidateTemplates(data, true); err != nil {
+			return fmt.Errorf("failed to render template fixture %s: %w", fixture, err)
+		}
+	}
+	if len(c.TemplateValidation.Fixtures) > 0 {
+		return nil
+	}
+	// Errors not caused by the missing keys, such as unknown fields or failing functions, would fail with any alert.
+	sample := issuetemplate.SampleData()
+	if err := c.Route.ValidateTemplates(sample, false); err != nil {
+		return fmt.Errorf("failed to render the built-in sample data: %w", err)
+	}
+	if err := c.Route.ValidateTemplates(sample, true); err != nil {
+		err = fmt.Errorf("failed to render the built-in sample data: %w", err)
+		if c.TemplateValidation.Strict {
+			return err
+		}
+		c.TemplateWarning = err
+	}
+	return nil
+}
+
+// CredentialFiles returns the files with credentials of the selected issue tracker.
+func (c *Config) CredentialFiles() []string {
+	if c.DryRun {
+		return nil
+	}
+	switch c.Tracker {
+	case TrackerGithub:
+		return []string{c.Github.TokenFile}
+	case TrackerGitea:
+		return []string{c.Gitea.TokenFile}
+	case TrackerJira:
+		return []string{c.Jira.TokenFile}
+	}
+	if c.Gitlab.OAuth != nil {
+		return []string{c.Gitlab.OAuth.ClientSecretFile}
+	}
+	if c.Gitlab.TokenEnv != "" {
+		return nil
+	}
+	return []string{c.Gitlab.TokenFile}
+}
+
+// Validate checks the config is complete and valid.
+func (c *Config) Validate() error {
+	if !contains(Trackers, c.Tracker) {
+		return fmt.Errorf("invalid tracker %q, supported are %v", c.Tracker, Trackers)
+	}
+	if !c.DryRun {
+		if err := c.validateTracker(); err != nil {
+			return err
+		}
+	}
+	if err := c.Route.Validate(!c.DryRun); err != nil {
+		return err
+	}
+	if !contains(AppendModes, c.IssueAppendMode) {
+		return fmt.Errorf("invalid issue append mode %q, supported are %v", c.IssueAppendMode, AppendModes)
+	}
+	for severity, sc := range c.Severities {
+		if sc.Milestone != "" && sc.CurrentMilestone {
+			return fmt.Errorf("the severity %s can't have both milestone and current_milestone set", severity)
+		}
+		if sc.Weight != nil && *sc.Weight < 0 {
+			return fmt.Errorf("the severity %s has negative weight %d", severity, *sc.Weight)
+		}
+	}
+	for alertSeverity, incidentSeverity := range c.Incident.SeverityMapping {
+		if !contains(IncidentSeverities, incidentSeverity) {
+			return fmt.Errorf("invalid incident severity %q for alert severity %s, supported are %v", incidentSeverity, alertSeverity, IncidentSeverities)
+		}
+	}
+	if c.Grafana.URL != "" {
+		if u, err := url.Parse(c.Grafana.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid Grafana URL %q", c.Grafana.URL)
+		}
+	}
+	if c.Retry.Limit < 1 {
+		return fmt.Errorf("the retry limit has to be at least 1, got %d", c.Retry.Limit)
+	}
+	if time.Duration(c.Retry.Backoff) <= 0 {
+		return fmt.Errorf("the retry backoff has to be positive, got %s", c.Retry.Backoff)
+	}
+	if c.Retry.MaxBackoff < c.Retry.Backoff {
+		return fmt.Errorf("the retry max backoff %s has to be at least the retry backoff %s", c.Retry.MaxBackoff, c.Retry.Backoff)
+	}
+	return nil
+}
+
+// validateTracker checks settings of the selected issue tracker.
+func (c *Config) validateTracker() error {
+	switch c.Tracker {
+	case TrackerGitlab:
+		if c.Gitlab.URL == "" {
+			return fmt.Errorf("the gitlab url has to be configured")
+		}
+		if c.Gitlab.OAuth != nil && (c.Gitlab.OAuth.ClientID == "" || c.Gitlab.OAuth.ClientSecretFile == "") {
+			return fmt.Errorf("the gitlab oauth client id and client secret file have to be configured")
+		}
+		if c.Gitlab.OAuth == nil && c.Gitlab.TokenEnv == "" && c.Gitlab.TokenFile == "" {
+			return fmt.Errorf("the gitlab token file, token environment variable or oauth has to be configured")
+		}
+		if c.Gitlab.RateLimit.RequestsPerSecond < 0 {
+			return fmt.Errorf("the gitlab rate limit can't be negative, got %v", c.Gitlab.RateLimit.RequestsPerSecond)
+		}
+		if c.Gitlab.RateLimit.RequestsPerSecond > 0 && c.Gitlab.RateLimit.Burst < 1 {
+			return fmt.Errorf("the gitlab rate limit burst has to be at least 1, got %d", c.Gitlab.RateLimit.Burst)
+		}
+	case TrackerGithub:
+		if err := validateAPI("github", c.Github.URL, c.Github.TokenFile); err != nil {
+			return err
+		}
+	case TrackerGitea:
+		if err := validateAPI("gitea", c.Gitea.URL, c.Gitea.TokenFile); err != nil {
+			return err
+		}
+	case TrackerJira:
+		if err := validateAPI("jira", c.Jira.URL, c.Jira.TokenFile); err != nil {
+			return err
+		}
+		if c.Jira.IssueType == "" {
+			return fmt.Errorf("the jira issue type has to be configured")
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func validateAPI(name string, url string, tokenFile string) error {
+	if url == "" {
+		return fmt.Errorf("the %s url has to be configured", name)
+	}
+	if tokenFile == "" {
+		return fmt.Errorf("the %s token file has to be configured", name)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// testConfig returns config with the defaults normally given by the flags.
+func testConfig(dryRun bool) *Config {
+	return &Config{
+		Tracker:         TrackerGitlab,
+		IssueAppendMode: AppendModeDescription,
+		Retry:           RetryConfig{Limit: 5, Backoff: model.Duration(time.Minute), MaxBackoff: model.Duration(time.Hour)},
+		DryRun:          dryRun,
+	}
+}
+
+func TestLoadFileWithoutProject(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("route:\n  issue_labels: [alert]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		dryRun bool
+		err    string
+	}{
+		{name: "render", dryRun: true},
+		{name: "issue tracker", dryRun: false, err: "project"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(tt.dryRun)
+			// The token is set, so the config fails only because of the missing project.
+			cfg.Gitlab = GitlabConfig{URL: "https://gitlab.example.com", TokenEnv: "GITLAB_TOKEN"}
+			err := LoadFile(path, cfg)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if cfg.Route.IssueTemplate == nil {
+					t.Fatal("expected the default issue template to be loaded")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
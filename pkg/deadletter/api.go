@@ -0,0 +1,72 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/queue"
+	"github.com/gorilla/mux"
+)
+
+// HandleInRouter registers the admin endpoints listing the stored entries and replaying them to the alert queue.
+// The entries contain the alerts, so the router should authenticate the requests.
+func (s *Store) HandleInRouter(router *mux.Router, alertQueue *queue.Queue) {
+	push := func(w *alertmanager.Webhook) error {
+		return alertQueue.Push(w)
+	}
+	router.HandleFunc("/-/dead-letters", s.listHandler).Methods(http.MethodGet)
+	router.HandleFunc("/-/dead-letters/replay", func(w http.ResponseWriter, _ *http.Request) {
+		replayed, err := s.ReplayAll(push)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Replayed %d alerts, failed to replay the rest: %s", replayed, err), http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, map[string]int{"replayed": replayed})
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/-/dead-letters/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		err := s.Replay(mux.Vars(r)["id"], push)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrReplaying) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to replay alert: %s", err), http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, map[string]int{"replayed": 1})
+	}).Methods(http.MethodPost)
+}
+
+func (s *Store) listHandler(w http.ResponseWriter, _ *http.Request) {
+	entries, err := s.List()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list dead-letter entries: %s", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entries)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
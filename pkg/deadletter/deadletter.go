@@ -0,0 +1,256 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons why the alert was dropped.
+const (
+	ReasonRetriesExhausted = "retries_exhausted"
+	ReasonPermanentError   = "permanent_error"
+	ReasonQueueError       = "queue_error"
+)
+
+const entryFileSuffix = ".json"
+
+var (
+	validID = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+	storedEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "prometheus_gitlab_notifier_dead_letters",
+		Help: "Number of dropped alerts in the dead-letter store waiting to be replayed.",
+	})
+)
+
+func init() {
+	metrics.Register(storedEntries)
+}
+
+// ErrNotFound is returned if there is no entry with the given ID in the Store.
+var ErrNotFound = errors.New("dead-letter entry not found")
+
+// ErrReplaying is returned if the entry with the given ID is already being replayed.
+var ErrReplaying = errors.New("dead-letter entry is already being replayed")
+
+// Entry is the alert dropped by the processor together with the reason it was dropped.
+type Entry struct {
+	ID         string          `json:"id"`
+	DroppedAt  time.Time       `json:"dropped_at"`
+	Reason     string          `json:"reason"`
+	Error      string          `json:"error"`
+	RetryCount int             `json:"retry_count"`
+	Message    webhook.Message `json:"message"`
+}
+
+// New returns new Store keeping the dropped alerts as separate files in the directory.
+func New(logger log.FieldLogger, dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		logger:    logger,
+		dir:       dir,
+		replaying: map[string]bool{},
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	storedEntries.Set(float64(len(ids)))
+	return s, nil
+}
+
+// Store is the dead-letter store of the alerts which could not be processed, so they can be replayed later.
+type Store struct {
+	logger log.FieldLogger
+	dir    string
+	mtx    sync.Mutex
+	seq    uint64
+	// replaying holds IDs of the entries being replayed, so they are not replayed twice at once.
+	replaying map[string]bool
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+entryFileSuffix)
+}
+
+// ids returns IDs of all the stored entries in the order they were added.
+func (s *Store) ids() ([]string, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range dirEntries {
+		id := strings.TrimSuffix(e.Name(), entryFileSuffix)
+		if e.IsDir() || !strings.HasSuffix(e.Name(), entryFileSuffix) || !validID.MatchString(id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Add stores the dropped alert with the reason and the last error it failed with.
+func (s *Store) Add(w *alertmanager.Webhook, reason string, lastErr error) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.seq++
+	entry := Entry{
+		ID:         fmt.Sprintf("%020d-%010d", time.Now().UnixNano(), s.seq),
+		DroppedAt:  time.Now(),
+		Reason:     reason,
+		RetryCount: w.RetryCount(),
+		Message:    w.Message,
+	}
+	if lastErr != nil {
+		entry.Error = lastErr.Error()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Write the file atomically, so partially written entry is never read.
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(entry.ID)); err != nil {
+		return err
+	}
+	storedEntries.Inc()
+	s.logger.WithFields(log.Fields{"group_key": w.GroupKey, "id": entry.ID, "reason": reason}).Info("stored dropped alert to the dead-letter store")
+	return nil
+}
+
+func (s *Store) get(id string) (*Entry, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("invalid dead-letter entry %s: %w", id, err)
+	}
+	entry.ID = id
+	return &entry, nil
+}
+
+// List returns all the stored entries in the order they were added.
+func (s *Store) List() ([]*Entry, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(ids))
+	for _, id := range ids {
+		entry, err := s.get(id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Replay passes the alert of the entry with the given ID to the replay function and removes the entry if it succeeds.
+// The store is not locked while the replay function runs, since it may block until the alerts are processed,
+// and the processing may need to add the alerts dropped meanwhile to the store.
+func (s *Store) Replay(id string, replayFunc func(w *alertmanager.Webhook) error) error {
+	s.mtx.Lock()
+	if s.replaying[id] {
+		s.mtx.Unlock()
+		return ErrReplaying
+	}
+	entry, err := s.get(id)
+	if err != nil {
+		s.mtx.Unlock()
+		return err
+	}
+	s.replaying[id] = true
+	s.mtx.Unlock()
+	defer func() {
+		s.mtx.Lock()
+		delete(s.replaying, id)
+		s.mtx.Unlock()
+	}()
+
+	if err := replayFunc(alertmanager.NewWebhookFromAlertmanagerMessage(entry.Message)); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id)); err != nil {
+		return err
+	}
+	storedEntries.Dec()
+	s.logger.WithFields(log.Fields{"group_key": entry.Message.GroupKey, "id": id}).Info("replayed alert from the dead-letter store")
+	return nil
+}
+
+// ReplayAll replays all the stored entries in the order they were added and returns number of the replayed ones.
+// Entries removed or being replayed meanwhile are skipped and not counted.
+// Stops on the first failure, so the rest of the entries stays stored.
+func (s *Store) ReplayAll(replayFunc func(w *alertmanager.Webhook) error) (int, error) {
+	s.mtx.Lock()
+	ids, err := s.ids()
+	s.mtx.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, id := range ids {
+		err := s.Replay(id, replayFunc)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrReplaying) {
+			continue
+		}
+		if err != nil {
+			return replayed, fmt.Errorf("failed to replay dead-letter entry %s: %w", id, err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadletter
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	log "github.com/sirupsen/logrus"
+)
+
+func testStore(t *testing.T) *Store {
+	logger := log.New()
+	logger.Out = io.Discard
+	s, err := New(logger, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testWebhook(groupKey string) *alertmanager.Webhook {
+	return alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{Data: &template.Data{}, GroupKey: groupKey})
+}
+
+func TestAddWhileReplayBlocks(t *testing.T) {
+	s := testStore(t)
+	if err := s.Add(testWebhook("a"), ReasonRetriesExhausted, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The replay blocks as the push to full queue would, until the alert is dropped again.
+	unblock := make(chan struct{})
+	replayed := make(chan error)
+	go func() {
+		replayed <- s.Replay(entries[0].ID, func(w *alertmanager.Webhook) error {
+			<-unblock
+			return nil
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := s.Replay(entries[0].ID, func(w *alertmanager.Webhook) error { return nil }); !errors.Is(err, ErrReplaying) {
+		t.Fatalf("expected ErrReplaying for concurrent replay, got %v", err)
+	}
+	added := make(chan error)
+	go func() { added <- s.Add(testWebhook("b"), ReasonPermanentError, nil) }()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Add blocked by the pending replay")
+	}
+	close(unblock)
+	if err := <-replayed; err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Message.GroupKey != "b" {
+		t.Fatalf("expected only the alert added during the replay to be stored, got %d entries", len(entries))
+	}
+}
+
+func TestReplayAllCountsOnlyReplayedEntries(t *testing.T) {
+	s := testStore(t)
+	for _, groupKey := range []string{"a", "b", "c"} {
+		if err := s.Add(testWebhook(groupKey), ReasonPermanentError, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry b is being replayed by another request for the whole time.
+	unblock := make(chan struct{})
+	replayedB := make(chan error)
+	go func() {
+		replayedB <- s.Replay(entries[1].ID, func(w *alertmanager.Webhook) error {
+			<-unblock
+			return nil
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var pushed []string
+	replayed, err := s.ReplayAll(func(w *alertmanager.Webhook) error {
+		if w.GroupKey == "a" {
+			// The entry c is replayed and removed by another request meanwhile.
+			if err := s.Replay(entries[2].ID, func(w *alertmanager.Webhook) error { return nil }); err != nil {
+				return err
+			}
+		}
+		pushed = append(pushed, w.GroupKey)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 || len(pushed) != 1 || pushed[0] != "a" {
+		t.Fatalf("expected only the entry a replayed and counted, got %d replayed and pushed %v", replayed, pushed)
+	}
+	close(unblock)
+	if err := <-replayedB; err != nil {
+		t.Fatal(err)
+	}
+}
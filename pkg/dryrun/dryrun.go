@@ -0,0 +1,208 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Outputs of the rendered issues.
+const (
+	OutputLog  = "log"
+	OutputFile = "file"
+)
+
+// Outputs lists all the supported outputs.
+var Outputs = []string{OutputLog, OutputFile}
+
+// Actions the issue tracker would do with the rendered issue.
+const (
+	// ActionCreateOrAppend creates new issue or appends the alert to an open issue with the same grouping labels created within the group interval.
+	ActionCreateOrAppend = "create_or_append"
+	// ActionResolve adds the alert as resolved to all the open issues with the same grouping labels.
+	ActionResolve = "resolve"
+)
+
+// Issue is the rendered issue the issue tracker would create or update.
+type Issue struct {
+	RenderedAt time.Time `json:"rendered_at"`
+	GroupKey   string    `json:"group_key"`
+	Action     string    `json:"action"`
+	// Close is set if the resolved issues would be closed.
+	Close       bool   `json:"close,omitempty"`
+	Project     string `json:"project"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Labels are all the labels of the created issue.
+	Labels []string `json:"labels"`
+	// StaticLabels are the issue labels configured in the route.
+	StaticLabels []string `json:"static_labels"`
+	// GroupingLabels are the group labels of the alert, used together with the static labels to look up the open issues of the same alert group.
+	GroupingLabels []string `json:"grouping_labels"`
+	// DynamicLabels are values of the alert labels configured as dynamic labels in the route.
+	DynamicLabels []string `json:"dynamic_labels"`
+}
+
+// Output writes the rendered issues.
+type Output interface {
+	Write(issue *Issue) error
+}
+
+// NewLogOutput returns Output logging the rendered issues.
+func NewLogOutput(logger log.FieldLogger) Output {
+	return &logOutput{logger: logger}
+}
+
+type logOutput struct {
+	logger log.FieldLogger
+}
+
+// Write logs the issue.
+func (o *logOutput) Write(issue *Issue) error {
+	o.logger.WithFields(log.Fields{
+		"group_key":       issue.GroupKey,
+		"action":          issue.Action,
+		"close":           issue.Close,
+		"project":         issue.Project,
+		"title":           issue.Title,
+		"description":     issue.Description,
+		"labels":          issue.Labels,
+		"static_labels":   issue.StaticLabels,
+		"grouping_labels": issue.GroupingLabels,
+		"dynamic_labels":  issue.DynamicLabels,
+	}).Info("dry run, rendered issue")
+	return nil
+}
+
+// NewFileOutput returns Output writing each rendered issue as JSON file to the directory.
+func NewFileOutput(dir string) (Output, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("the output directory has to be set for the %s output", OutputFile)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &fileOutput{dir: dir}, nil
+}
+
+type fileOutput struct {
+	dir string
+	mtx sync.Mutex
+	seq uint64
+}
+
+// Write writes the issue to new file named by the time it was rendered, so the files sort in the order of the alerts.
+func (o *fileOutput) Write(issue *Issue) error {
+	data, err := json.MarshalIndent(issue, "", "  ")
+	if err != nil {
+		return err
+	}
+	o.mtx.Lock()
+	o.seq++
+	name := fmt.Sprintf("%d-%d.json", issue.RenderedAt.UnixNano(), o.seq)
+	o.mtx.Unlock()
+	return os.WriteFile(filepath.Join(o.dir, name), data, 0o640)
+}
+
+// New returns IssueTracker which only renders the issues and writes them to the output, the issue tracker is not called at all.
+func New(logger log.FieldLogger, cfg *config.Config, output Output) *DryRun {
+	return &DryRun{
+		logger:         logger,
+		rootRoute:      cfg.Route,
+		closeOnResolve: cfg.CloseOnResolve,
+		output:         output,
+	}
+}
+
+// DryRun renders the issues the same way the issue trackers do, so the templates and routing can be tested on real alerts.
+type DryRun struct {
+	logger         log.FieldLogger
+	rootRoute      *routing.Route
+	closeOnResolve bool
+	output         Output
+}
+
+// CreateIssue renders the issue from the Webhook and writes it to the output.
+func (d *DryRun) CreateIssue(ctx context.Context, msg *alertmanager.Webhook) (err error) {
+	ctx, span := tracing.Start(ctx, "DryRun.CreateIssue")
+	defer func() { tracing.EndSpan(span, err) }()
+	logger := tracing.Logger(ctx, d.logger)
+
+	issue, err := Render(logger, d.rootRoute, d.closeOnResolve, msg)
+	if err != nil {
+		return err
+	}
+	if err := d.output.Write(issue); err != nil {
+		metrics.ReportError("FailedToWriteDryRunIssue", "")
+		logger.WithFields(log.Fields{"err": err, "group_key": msg.GroupKey}).Error("failed to write the rendered issue")
+		return err
+	}
+	return nil
+}
+
+// Render routes the alert and renders the issue the same way the issue trackers do.
+func Render(logger log.FieldLogger, rootRoute *routing.Route, closeOnResolve bool, msg *alertmanager.Webhook) (*Issue, error) {
+	route := rootRoute.Match(msg)
+	issueText, err := tracker.RenderIssueTemplate(logger, route, msg)
+	if err != nil {
+		return nil, err
+	}
+	issue := &Issue{
+		RenderedAt:     time.Now(),
+		GroupKey:       msg.GroupKey,
+		Action:         ActionCreateOrAppend,
+		Project:        route.Project,
+		Title:          tracker.RenderIssueTitle(logger, route, msg),
+		Description:    issueText.String(),
+		StaticLabels:   route.IssueLabels,
+		GroupingLabels: tracker.ExtractGroupingLabels(msg),
+		DynamicLabels:  tracker.ExtractDynamicLabels(route, msg),
+	}
+	// The labels are extracted from maps, so they are sorted to be rendered the same way every time.
+	sort.Strings(issue.GroupingLabels)
+	sort.Strings(issue.DynamicLabels)
+	if msg.Status == string(model.AlertResolved) {
+		issue.Action = ActionResolve
+		issue.Close = closeOnResolve && tracker.AllAlertsResolved(msg)
+	}
+	// Same labels as the issue trackers set to the created issue, the duplicates are ignored by the issue trackers.
+	var labels []string
+	labels = append(labels, issue.StaticLabels...)
+	labels = append(labels, issue.GroupingLabels...)
+	labels = append(labels, issue.DynamicLabels...)
+	seen := map[string]bool{}
+	for _, l := range labels {
+		if !seen[l] {
+			seen[l] = true
+			issue.Labels = append(issue.Labels, l)
+		}
+	}
+	return issue, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/issuetemplate"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	log "github.com/sirupsen/logrus"
+)
+
+const testTemplate = `{{define "title"}}Alert {{ .CommonLabels.alertname }} in {{ .CommonLabels.locality }}{{end}}{{ .CommonAnnotations.title }}
+{{ range .Alerts }}- {{ .Annotations.description }}
+{{ end }}`
+
+func loadFixture(t *testing.T, status string) *alertmanager.Webhook {
+	t.Helper()
+	contents, err := os.ReadFile("../../conf/alert.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message webhook.Message
+	if err := json.Unmarshal(contents, &message); err != nil {
+		t.Fatal(err)
+	}
+	message.Status = status
+	for i := range message.Alerts {
+		message.Alerts[i].Status = status
+	}
+	return alertmanager.NewWebhookFromAlertmanagerMessage(message)
+}
+
+func TestFileOutput(t *testing.T) {
+	logger := log.New()
+	logger.Out = io.Discard
+	tpl, err := issuetemplate.Parse("issue", testTemplate, issuetemplate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	titleTpl, err := issuetemplate.TitleTemplate(tpl, "", issuetemplate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		CloseOnResolve: true,
+		Route: &routing.Route{
+			Project:            "group/project",
+			IssueLabels:        []string{"alert"},
+			DynamicIssueLabels: []string{"app"},
+			IssueTemplate:      tpl,
+			IssueTitleTemplate: titleTpl,
+		},
+	}
+	dir := filepath.Join(t.TempDir(), "issues")
+	output, err := NewFileOutput(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(logger, cfg, output)
+	for _, status := range []string{"firing", "resolved"} {
+		if err := d.CreateIssue(context.Background(), loadFixture(t, status)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected issue written for each alert, got files %v", files)
+	}
+	expected := []struct {
+		action string
+		close  bool
+	}{{action: ActionCreateOrAppend}, {action: ActionResolve, close: true}}
+	for i, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var issue Issue
+		if err := json.Unmarshal(contents, &issue); err != nil {
+			t.Fatalf("invalid JSON of the rendered issue %s: %v", file, err)
+		}
+		if issue.Action != expected[i].action || issue.Close != expected[i].close {
+			t.Errorf("expected action %s with close %v, got %s with close %v", expected[i].action, expected[i].close, issue.Action, issue.Close)
+		}
+		if issue.GroupKey != "meh" || issue.Project != "group/project" {
+			t.Errorf("expected group key meh routed to group/project, got %s routed to %s", issue.GroupKey, issue.Project)
+		}
+		if issue.Title != "Alert ThisIsATestingAlert in nagano" {
+			t.Errorf("expected rendered title, got %q", issue.Title)
+		}
+		if expectedDescription := "Something is wrong!!!\n- this is a testing alert\n"; issue.Description != expectedDescription {
+			t.Errorf("expected description %q, got %q", expectedDescription, issue.Description)
+		}
+		if expectedLabels := []string{"alert", "label::value", "app::test"}; !reflect.DeepEqual(issue.Labels, expectedLabels) {
+			t.Errorf("expected labels %v, got %v", expectedLabels, issue.Labels)
+		}
+	}
+}
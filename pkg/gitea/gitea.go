@@ -0,0 +1,228 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+)
+
+const (
+	pageLimit = 50
+	// Color of the labels created by the notifier.
+	labelColor = "#e11d21"
+)
+
+// New returns new Gitea (or Forgejo) issues backend of the tracker.Simple.
+func New(cfg config.GiteaConfig, token string) *Gitea {
+	return &Gitea{
+		client: tracker.NewHTTPClient(config.TrackerGitea, strings.TrimSuffix(cfg.URL, "/")+"/api/v1", func(r *http.Request) {
+			r.Header.Set("Authorization", "token "+token)
+		}),
+		labelIDs: map[string]map[string]int{},
+	}
+}
+
+// Gitea creates issues in Gitea or Forgejo repositories, the project is the repository in format `owner/repo`.
+type Gitea struct {
+	client *tracker.HTTPClient
+	// Gitea API works with label IDs, so the IDs of label names are cached per repository.
+	// The mutex is not held during the API calls, so slow Gitea does not block the lookups of the cached labels.
+	labelIDs    map[string]map[string]int
+	labelIDsMtx sync.Mutex
+	// Serializes creating of the missing labels, so the label is not created twice by concurrently processed alerts.
+	createLabelMtx sync.Mutex
+}
+
+type giteaLabel struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type giteaIssue struct {
+	Number    int          `json:"number"`
+	Body      string       `json:"body"`
+	Labels    []giteaLabel `json:"labels"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func (i *giteaIssue) toIssue() *tracker.Issue {
+	var labels []string
+	for _, l := range i.Labels {
+		labels = append(labels, l.Name)
+	}
+	return &tracker.Issue{ID: strconv.Itoa(i.Number), Description: i.Body, Labels: labels, CreatedAt: i.CreatedAt}
+}
+
+// Name of the issue tracking system.
+func (g *Gitea) Name() string {
+	return config.TrackerGitea
+}
+
+func (g *Gitea) loadLabels(ctx context.Context, project string) (map[string]int, error) {
+	ids := map[string]int{}
+	for page := 1; ; page++ {
+		var labels []giteaLabel
+		if _, err := g.client.Do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/labels?page=%d&limit=%d", project, page, pageLimit), nil, &labels); err != nil {
+			return nil, err
+		}
+		for _, l := range labels {
+			ids[l.Name] = l.ID
+		}
+		if len(labels) < pageLimit {
+			return ids, nil
+		}
+	}
+}
+
+func (g *Gitea) cachedLabelID(project string, name string) (id int, loaded bool, ok bool) {
+	g.labelIDsMtx.Lock()
+	defer g.labelIDsMtx.Unlock()
+	ids, loaded := g.labelIDs[project]
+	id, ok = ids[name]
+	return id, loaded, ok
+}
+
+func (g *Gitea) cacheLabelIDs(project string, ids map[string]int) {
+	g.labelIDsMtx.Lock()
+	defer g.labelIDsMtx.Unlock()
+	if g.labelIDs[project] == nil {
+		g.labelIDs[project] = map[string]int{}
+	}
+	for name, id := range ids {
+		g.labelIDs[project][name] = id
+	}
+}
+
+func (g *Gitea) createLabel(ctx context.Context, project string, name string) (int, error) {
+	g.createLabelMtx.Lock()
+	defer g.createLabelMtx.Unlock()
+	// The label could have been created while waiting for the lock.
+	if id, _, ok := g.cachedLabelID(project, name); ok {
+		return id, nil
+	}
+	var created giteaLabel
+	body := map[string]string{"name": name, "color": labelColor}
+	if _, err := g.client.Do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/labels", project), body, &created); err != nil {
+		return 0, err
+	}
+	g.cacheLabelIDs(project, map[string]int{name: created.ID})
+	return created.ID, nil
+}
+
+// getLabelIDs returns IDs of the labels, the missing labels are created in the repository.
+func (g *Gitea) getLabelIDs(ctx context.Context, project string, labels []string) ([]int, error) {
+	var res []int
+	for _, name := range labels {
+		id, loaded, ok := g.cachedLabelID(project, name)
+		if !loaded {
+			ids, err := g.loadLabels(ctx, project)
+			if err != nil {
+				return nil, err
+			}
+			g.cacheLabelIDs(project, ids)
+			id, ok = ids[name]
+		}
+		if !ok {
+			var err error
+			if id, err = g.createLabel(ctx, project, name); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, id)
+	}
+	return res, nil
+}
+
+// ListOpenIssues returns open issues having all the labels, created after the given time if set, newest first.
+func (g *Gitea) ListOpenIssues(ctx context.Context, project string, labels []string, createdAfter *time.Time) ([]*tracker.Issue, error) {
+	query := url.Values{
+		"state":  {"open"},
+		"type":   {"issues"},
+		"labels": {strings.Join(labels, ",")},
+		"limit":  {strconv.Itoa(pageLimit)},
+	}
+	if createdAfter != nil {
+		// Gitea filters only by the update time, but any issue created after the time was also updated after it.
+		query.Set("since", createdAfter.Format(time.RFC3339))
+	}
+	var res []*tracker.Issue
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var issues []giteaIssue
+		if _, err := g.client.Do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/issues?%s", project, query.Encode()), nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, i := range issues {
+			if createdAfter != nil && i.CreatedAt.Before(*createdAfter) {
+				continue
+			}
+			res = append(res, i.toIssue())
+		}
+		if len(issues) < pageLimit {
+			break
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].CreatedAt.After(res[j].CreatedAt) })
+	return res, nil
+}
+
+// CreateIssue creates new issue and returns its number.
+func (g *Gitea) CreateIssue(ctx context.Context, project string, title string, description string, labels []string) (string, error) {
+	labelIDs, err := g.getLabelIDs(ctx, project, labels)
+	if err != nil {
+		return "", err
+	}
+	var created giteaIssue
+	body := map[string]interface{}{"title": title, "body": description, "labels": labelIDs}
+	if _, err := g.client.Do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues", project), body, &created); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(created.Number), nil
+}
+
+// UpdateIssue sets the description and labels of the issue.
+func (g *Gitea) UpdateIssue(ctx context.Context, project string, issue *tracker.Issue) error {
+	labelIDs, err := g.getLabelIDs(ctx, project, issue.Labels)
+	if err != nil {
+		return err
+	}
+	if _, err := g.client.Do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%s", project, issue.ID), map[string]string{"body": issue.Description}, nil); err != nil {
+		return err
+	}
+	_, err = g.client.Do(ctx, http.MethodPut, fmt.Sprintf("/repos/%s/issues/%s/labels", project, issue.ID), map[string][]int{"labels": labelIDs}, nil)
+	return err
+}
+
+// AddComment adds comment to the issue.
+func (g *Gitea) AddComment(ctx context.Context, project string, issue *tracker.Issue, body string) error {
+	_, err := g.client.Do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%s/comments", project, issue.ID), map[string]string{"body": body}, nil)
+	return err
+}
+
+// CloseIssue closes the issue.
+func (g *Gitea) CloseIssue(ctx context.Context, project string, issue *tracker.Issue) error {
+	_, err := g.client.Do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%s", project, issue.ID), map[string]string{"state": "closed"}, nil)
+	return err
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+)
+
+type apiRequest struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   map[string]interface{}
+}
+
+// fakeAPI records the requests and responds with the response configured for "METHOD path", 404 otherwise.
+type fakeAPI struct {
+	mtx       sync.Mutex
+	requests  []apiRequest
+	responses map[string]string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := apiRequest{method: r.Method, path: r.URL.Path, query: r.URL.Query(), header: r.Header}
+	_ = json.NewDecoder(r.Body).Decode(&req.body)
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.requests = append(f.requests, req)
+	response, ok := f.responses[r.Method+" "+r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(response))
+}
+
+func (f *fakeAPI) recorded() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var res []string
+	for _, r := range f.requests {
+		res = append(res, r.method+" "+r.path)
+	}
+	return res
+}
+
+func (f *fakeAPI) count(request string) int {
+	n := 0
+	for _, r := range f.recorded() {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+func newTestGitea(t *testing.T, responses map[string]string) (*Gitea, *fakeAPI) {
+	t.Helper()
+	fake := &fakeAPI{responses: responses}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return New(config.GiteaConfig{URL: srv.URL + "/"}, "token"), fake
+}
+
+func TestCreateIssue(t *testing.T) {
+	g, fake := newTestGitea(t, map[string]string{
+		"GET /api/v1/repos/o/r/labels":  `[{"id":1,"name":"alert"}]`,
+		"POST /api/v1/repos/o/r/labels": `{"id":2,"name":"alertname::Foo"}`,
+		"POST /api/v1/repos/o/r/issues": `{"number":7}`,
+	})
+	for i := 0; i < 2; i++ {
+		id, err := g.CreateIssue(context.Background(), "o/r", "Firing alert", "description", []string{"alert", "alertname::Foo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "7" {
+			t.Errorf("expected issue number 7, got %s", id)
+		}
+	}
+	expected := []string{
+		"GET /api/v1/repos/o/r/labels",
+		"POST /api/v1/repos/o/r/labels",
+		"POST /api/v1/repos/o/r/issues",
+		// The label IDs are cached.
+		"POST /api/v1/repos/o/r/issues",
+	}
+	if got := fake.recorded(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected requests %v, got %v", expected, got)
+	}
+	if got := fake.requests[0].header.Get("Authorization"); got != "token token" {
+		t.Errorf("expected token authorization, got %q", got)
+	}
+	if got := fake.requests[1].body; got["name"] != "alertname::Foo" || got["color"] != labelColor {
+		t.Errorf("expected missing label created, got %v", got)
+	}
+	issue := map[string]interface{}{"title": "Firing alert", "body": "description", "labels": []interface{}{float64(1), float64(2)}}
+	if got := fake.requests[3].body; !reflect.DeepEqual(got, issue) {
+		t.Errorf("expected issue %v, got %v", issue, got)
+	}
+}
+
+func TestMissingLabelCreatedOnce(t *testing.T) {
+	g, fake := newTestGitea(t, map[string]string{
+		"GET /api/v1/repos/o/r/labels":  `[]`,
+		"POST /api/v1/repos/o/r/labels": `{"id":2,"name":"alert"}`,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.getLabelIDs(context.Background(), "o/r", []string{"alert"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := fake.count("POST /api/v1/repos/o/r/labels"); got != 1 {
+		t.Errorf("expected the label created once, got %d times", got)
+	}
+}
+
+func TestUpdateExistingIssue(t *testing.T) {
+	now := time.Now().UTC()
+	issues, _ := json.Marshal([]map[string]interface{}{
+		{"number": 7, "body": "updated but too old", "created_at": now.Add(-2 * time.Hour)},
+		{"number": 8, "body": "older", "created_at": now.Add(-time.Minute)},
+		{"number": 9, "body": "newest", "labels": []map[string]interface{}{{"id": 1, "name": "alert"}}, "created_at": now},
+	})
+	g, fake := newTestGitea(t, map[string]string{
+		"GET /api/v1/repos/o/r/issues":          string(issues),
+		"GET /api/v1/repos/o/r/labels":          `[{"id":1,"name":"alert"},{"id":3,"name":"appended-alerts::1"}]`,
+		"PATCH /api/v1/repos/o/r/issues/9":      `{"number":9}`,
+		"PUT /api/v1/repos/o/r/issues/9/labels": `[]`,
+	})
+	since := now.Add(-time.Hour)
+	found, err := g.ListOpenIssues(context.Background(), "o/r", []string{"alert"}, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].ID != "9" || found[1].ID != "8" || !reflect.DeepEqual(found[0].Labels, []string{"alert"}) {
+		t.Fatalf("expected issues 9 and 8 created within the hour newest first, got %+v", found)
+	}
+	if query := fake.requests[0].query; query.Get("labels") != "alert" || query.Get("since") == "" || query.Get("state") != "open" {
+		t.Errorf("expected open issues listed by the labels and time, got query %v", query)
+	}
+	issue := &tracker.Issue{ID: "9", Description: "appended", Labels: []string{"alert", "appended-alerts::1"}}
+	if err := g.UpdateIssue(context.Background(), "o/r", issue); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.requests[2].body["body"]; got != "appended" {
+		t.Errorf("expected description updated, got %v", got)
+	}
+	if got := fake.requests[3].body["labels"]; !reflect.DeepEqual(got, []interface{}{float64(1), float64(3)}) {
+		t.Errorf("expected label IDs [1 3] set, got %v", got)
+	}
+}
+
+func TestResolveIssue(t *testing.T) {
+	g, fake := newTestGitea(t, map[string]string{
+		"POST /api/v1/repos/o/r/issues/8/comments": `{"id":1}`,
+		"PATCH /api/v1/repos/o/r/issues/8":         `{"number":8}`,
+	})
+	issue := &tracker.Issue{ID: "8"}
+	if err := g.AddComment(context.Background(), "o/r", issue, "resolved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CloseIssue(context.Background(), "o/r", issue); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.requests[0].body["body"]; got != "resolved" {
+		t.Errorf("expected resolution comment, got %v", got)
+	}
+	if got := fake.requests[1].body["state"]; got != "closed" {
+		t.Errorf("expected issue closed, got state %v", got)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+)
+
+// New returns new GitHub issues backend of the tracker.Simple.
+func New(cfg config.GithubConfig, token string) *GitHub {
+	return &GitHub{
+		client: tracker.NewHTTPClient(config.TrackerGithub, cfg.URL, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+			r.Header.Set("Accept", "application/vnd.github+json")
+			r.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		}),
+	}
+}
+
+// GitHub creates issues in GitHub repositories, the project is the repository in format `owner/repo`.
+type GitHub struct {
+	client *tracker.HTTPClient
+}
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+type githubIssue struct {
+	Number      int           `json:"number"`
+	Body        string        `json:"body"`
+	Labels      []githubLabel `json:"labels"`
+	CreatedAt   time.Time     `json:"created_at"`
+	PullRequest *struct{}     `json:"pull_request,omitempty"`
+}
+
+func (i *githubIssue) toIssue() *tracker.Issue {
+	var labels []string
+	for _, l := range i.Labels {
+		labels = append(labels, l.Name)
+	}
+	return &tracker.Issue{ID: strconv.Itoa(i.Number), Description: i.Body, Labels: labels, CreatedAt: i.CreatedAt}
+}
+
+// Name of the issue tracking system.
+func (g *GitHub) Name() string {
+	return config.TrackerGithub
+}
+
+// ListOpenIssues returns open issues having all the labels, created after the given time if set, newest first.
+func (g *GitHub) ListOpenIssues(ctx context.Context, project string, labels []string, createdAfter *time.Time) ([]*tracker.Issue, error) {
+	query := url.Values{
+		"state":     {"open"},
+		"labels":    {strings.Join(labels, ",")},
+		"sort":      {"created"},
+		"direction": {"desc"},
+		"per_page":  {"100"},
+	}
+	var res []*tracker.Issue
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var issues []githubIssue
+		if _, err := g.client.Do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/issues?%s", project, query.Encode()), nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, i := range issues {
+			// Since the issues are sorted by creation time, there can't be any newer ones.
+			if createdAfter != nil && i.CreatedAt.Before(*createdAfter) {
+				return res, nil
+			}
+			// The issues API returns also pull requests.
+			if i.PullRequest != nil {
+				continue
+			}
+			res = append(res, i.toIssue())
+		}
+		if len(issues) < 100 {
+			return res, nil
+		}
+	}
+}
+
+// CreateIssue creates new issue and returns its number.
+func (g *GitHub) CreateIssue(ctx context.Context, project string, title string, description string, labels []string) (string, error) {
+	var created githubIssue
+	body := map[string]interface{}{"title": title, "body": description, "labels": labels}
+	if _, err := g.client.Do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues", project), body, &created); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(created.Number), nil
+}
+
+// UpdateIssue sets the description and labels of the issue.
+func (g *GitHub) UpdateIssue(ctx context.Context, project string, issue *tracker.Issue) error {
+	body := map[string]interface{}{"body": issue.Description, "labels": issue.Labels}
+	_, err := g.client.Do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%s", project, issue.ID), body, nil)
+	return err
+}
+
+// AddComment adds comment to the issue.
+func (g *GitHub) AddComment(ctx context.Context, project string, issue *tracker.Issue, body string) error {
+	_, err := g.client.Do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%s/comments", project, issue.ID), map[string]string{"body": body}, nil)
+	return err
+}
+
+// CloseIssue closes the issue.
+func (g *GitHub) CloseIssue(ctx context.Context, project string, issue *tracker.Issue) error {
+	body := map[string]string{"state": "closed", "state_reason": "completed"}
+	_, err := g.client.Do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%s", project, issue.ID), body, nil)
+	return err
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+)
+
+type apiRequest struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   map[string]interface{}
+}
+
+// fakeAPI records the requests and responds with the response configured for "METHOD path", 404 otherwise.
+type fakeAPI struct {
+	mtx       sync.Mutex
+	requests  []apiRequest
+	responses map[string]string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := apiRequest{method: r.Method, path: r.URL.Path, query: r.URL.Query(), header: r.Header}
+	_ = json.NewDecoder(r.Body).Decode(&req.body)
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.requests = append(f.requests, req)
+	response, ok := f.responses[r.Method+" "+r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(response))
+}
+
+func (f *fakeAPI) recorded() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var res []string
+	for _, r := range f.requests {
+		res = append(res, r.method+" "+r.path)
+	}
+	return res
+}
+
+func newTestGitHub(t *testing.T, responses map[string]string) (*GitHub, *fakeAPI) {
+	t.Helper()
+	fake := &fakeAPI{responses: responses}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return New(config.GithubConfig{URL: srv.URL}, "token"), fake
+}
+
+func TestCreateIssue(t *testing.T) {
+	g, fake := newTestGitHub(t, map[string]string{"POST /repos/o/r/issues": `{"number":7}`})
+	id, err := g.CreateIssue(context.Background(), "o/r", "Firing alert", "description", []string{"alert", "alertname::Foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "7" {
+		t.Errorf("expected issue number 7, got %s", id)
+	}
+	req := fake.requests[0]
+	if req.header.Get("Authorization") != "Bearer token" {
+		t.Errorf("expected bearer token authorization, got %q", req.header.Get("Authorization"))
+	}
+	expected := map[string]interface{}{"title": "Firing alert", "body": "description", "labels": []interface{}{"alert", "alertname::Foo"}}
+	if !reflect.DeepEqual(req.body, expected) {
+		t.Errorf("expected issue %v, got %v", expected, req.body)
+	}
+}
+
+func TestUpdateExistingIssue(t *testing.T) {
+	now := time.Now().UTC()
+	issues, _ := json.Marshal([]map[string]interface{}{
+		{"number": 9, "body": "pull request", "created_at": now, "pull_request": map[string]string{}},
+		{"number": 8, "body": "newest", "labels": []map[string]string{{"name": "alert"}}, "created_at": now.Add(-time.Minute)},
+		{"number": 7, "body": "too old", "created_at": now.Add(-2 * time.Hour)},
+	})
+	g, fake := newTestGitHub(t, map[string]string{
+		"GET /repos/o/r/issues":     string(issues),
+		"PATCH /repos/o/r/issues/8": `{"number":8}`,
+	})
+	since := now.Add(-time.Hour)
+	found, err := g.ListOpenIssues(context.Background(), "o/r", []string{"alert", "alertname::Foo"}, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != "8" || !reflect.DeepEqual(found[0].Labels, []string{"alert"}) {
+		t.Fatalf("expected only the issue 8 created within the hour, got %+v", found)
+	}
+	if got := fake.requests[0].query.Get("labels"); got != "alert,alertname::Foo" {
+		t.Errorf("expected issues listed by the labels, got %q", got)
+	}
+	issue := &tracker.Issue{ID: "8", Description: "appended", Labels: []string{"alert", "appended-alerts::1"}}
+	if err := g.UpdateIssue(context.Background(), "o/r", issue); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"body": "appended", "labels": []interface{}{"alert", "appended-alerts::1"}}
+	if got := fake.requests[1].body; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected issue updated with %v, got %v", expected, got)
+	}
+}
+
+func TestResolveIssue(t *testing.T) {
+	g, fake := newTestGitHub(t, map[string]string{
+		"POST /repos/o/r/issues/8/comments": `{"id":1}`,
+		"PATCH /repos/o/r/issues/8":         `{"number":8}`,
+	})
+	issue := &tracker.Issue{ID: "8"}
+	if err := g.AddComment(context.Background(), "o/r", issue, "resolved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CloseIssue(context.Background(), "o/r", issue); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.requests[0].body["body"]; got != "resolved" {
+		t.Errorf("expected resolution comment, got %v", got)
+	}
+	if got := fake.requests[1].body["state"]; got != "closed" {
+		t.Errorf("expected issue closed, got state %v", got)
+	}
+	if err := g.CloseIssue(context.Background(), "o/r", &tracker.Issue{ID: "404"}); !tracker.IsPermanentError(err) {
+		t.Errorf("expected permanent error closing missing issue, got %v", err)
+	}
+	expected := []string{"POST /repos/o/r/issues/8/comments", "PATCH /repos/o/r/issues/8", "PATCH /repos/o/r/issues/404"}
+	if got := fake.recorded(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected requests %v, got %v", expected, got)
+	}
+}
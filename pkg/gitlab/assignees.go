@@ -0,0 +1,121 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	log "github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+)
+
+// userCache caches IDs of the Gitlab users by their username, so the Users API is not called for every issue.
+type userCache struct {
+	mtx sync.RWMutex
+	ids map[string]int
+}
+
+func (c *userCache) get(username string) (int, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	id, ok := c.ids[username]
+	return id, ok
+}
+
+func (c *userCache) set(username string, id int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.ids[username] = id
+}
+
+// extractAssignees collects all the users to assign the issue to, as configured in the AssigneesConfig.
+func (g *Gitlab) extractAssignees(msg *alertmanager.Webhook) []string {
+	cfg := g.assignees
+	var users = map[string]struct{}{}
+	addUsers := func(values ...string) {
+		for _, v := range values {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "@")
+			if v != "" {
+				users[v] = struct{}{}
+			}
+		}
+	}
+	for _, a := range msg.Alerts {
+		for _, l := range cfg.Labels {
+			if v, ok := a.Labels[l]; ok {
+				addUsers(v)
+			}
+		}
+		for l, mapping := range cfg.LabelValueMapping {
+			if v, ok := a.Labels[l]; ok {
+				addUsers(mapping[v]...)
+			}
+		}
+		if cfg.Annotation != "" {
+			if v, ok := a.Annotations[cfg.Annotation]; ok {
+				addUsers(strings.Split(v, ",")...)
+			}
+		}
+	}
+	var res []string
+	for u := range users {
+		res = append(res, u)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (g *Gitlab) resolveUserID(ctx context.Context, user string) (int, error) {
+	logger := tracing.Logger(ctx, g.logger)
+	if id, err := strconv.Atoi(user); err == nil {
+		return id, nil
+	}
+	if id, ok := g.userCache.get(user); ok {
+		return id, nil
+	}
+	users, response, err := g.client.Users.ListUsers(&gitlab.ListUsersOptions{Username: gitlab.String(user)}, gitlab.WithContext(ctx))
+	if err != nil {
+		metrics.ReportError("FailedToListGitlabUsers", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response, "username": user}).Error("failed to look up gitlab user")
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, fmt.Errorf("gitlab user %s not found", user)
+	}
+	g.userCache.set(user, users[0].ID)
+	return users[0].ID, nil
+}
+
+// getAssigneeIDs returns IDs of the users to assign the issue to. Users which can't be resolved are skipped, so the issue is created anyway.
+func (g *Gitlab) getAssigneeIDs(ctx context.Context, msg *alertmanager.Webhook) []int {
+	logger := tracing.Logger(ctx, g.logger)
+	var ids []int
+	for _, user := range g.extractAssignees(msg) {
+		id, err := g.resolveUserID(ctx, user)
+		if err != nil {
+			logger.WithFields(log.Fields{"err": err, "user": user}).Warn("failed to resolve issue assignee, skipping it")
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestExtractAssignees(t *testing.T) {
+	cfg := config.AssigneesConfig{
+		Labels:            []string{"owner"},
+		LabelValueMapping: map[string]map[string][]string{"team": {"db": {"alice", "@bob"}}},
+		Annotation:        "assignees",
+	}
+	tests := []struct {
+		name     string
+		alerts   template.Alerts
+		expected []string
+	}{
+		{name: "no assignees", alerts: template.Alerts{{Labels: template.KV{"team": "web"}}}},
+		{name: "user from label", alerts: template.Alerts{{Labels: template.KV{"owner": "@carol"}}}, expected: []string{"carol"}},
+		{name: "users mapped from label value", alerts: template.Alerts{{Labels: template.KV{"team": "db"}}}, expected: []string{"alice", "bob"}},
+		{name: "comma separated users from annotation", alerts: template.Alerts{{Annotations: template.KV{"assignees": "dave, @erin,,"}}}, expected: []string{"dave", "erin"}},
+		{
+			name: "users of all alerts are deduplicated and sorted",
+			alerts: template.Alerts{
+				{Labels: template.KV{"owner": "bob", "team": "db"}},
+				{Labels: template.KV{"owner": "42"}, Annotations: template.KV{"assignees": "alice"}},
+			},
+			expected: []string{"42", "alice", "bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Gitlab{assignees: cfg}
+			msg := alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{Data: &template.Data{Alerts: tt.alerts}})
+			if got := g.extractAssignees(msg); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected assignees %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCreateIssueWithAssignees(t *testing.T) {
+	fake := &fakeGitlab{responses: map[string]string{
+		"GET " + issuesPath:  `[]`,
+		"POST " + issuesPath: `{"id":10,"iid":1}`,
+		"GET /api/v4/users":  `[{"id":5,"username":"alice"}]`,
+	}}
+	g := newTestGitlab(t, fake)
+	g.assignees = config.AssigneesConfig{Annotation: "assignees"}
+	msg := testWebhook("firing", "firing")
+	msg.Alerts[0].Annotations = template.KV{"assignees": "alice,7"}
+	for i := 0; i < 2; i++ {
+		if err := g.CreateIssue(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		created := fake.request(t, http.MethodPost, issuesPath)
+		if got := created.body["assignee_ids"]; !reflect.DeepEqual(got, []interface{}{float64(7), float64(5)}) {
+			t.Errorf("expected assignee IDs [7 5], got %v", got)
+		}
+	}
+	lookups := 0
+	for _, r := range fake.recorded() {
+		if r == "GET /api/v4/users" {
+			lookups++
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("expected the username looked up once and then cached, got %d lookups", lookups)
+	}
+	if got := fake.request(t, http.MethodGet, "/api/v4/users").query.Get("username"); got != "alice" {
+		t.Errorf("expected lookup of user alice, got %q", got)
+	}
+}
@@ -14,40 +14,71 @@
 package gitlab
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"regexp"
-	"strconv"
-	"text/template"
+	"strings"
 	"time"
 
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+	"github.com/prometheus/common/model"
 	log "github.com/sirupsen/logrus"
 	"github.com/xanzy/go-gitlab"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// New creates new Gitlab instance configured to work with specified gitlab instance, project and with given authentication.
-func New(logger log.FieldLogger, url string, token string, projectID int, issueTemplate *template.Template, issueLabels *[]string, dynamicIssueLabels *[]string, groupInterval *time.Duration) (*Gitlab, error) {
-	cli, err := gitlab.NewClient(token, gitlab.WithBaseURL(url))
+// New creates new Gitlab instance configured to work with specified gitlab instance, routing of the alerts to projects and with given authentication.
+// If OAuth is configured, the token is ignored and the tokens are obtained using the OAuth client credentials flow.
+func New(logger log.FieldLogger, token string, cfg *config.Config) (*Gitlab, error) {
+	if err := cfg.Validate(); err != nil {
+		logger.WithFields(log.Fields{"err": err}).Error("invalid configuration")
+		return nil, err
+	}
+	opts := []gitlab.ClientOptionFunc{gitlab.WithBaseURL(cfg.Gitlab.URL)}
+	// Without the custom limiter, the client configures its own limiter based on the rate limit headers of the Gitlab.
+	if cfg.Gitlab.RateLimit.RequestsPerSecond > 0 {
+		opts = append(opts, gitlab.WithCustomLimiter(newRateLimiter(cfg.Gitlab.RateLimit)))
+	}
+	newClient := gitlab.NewClient
+	httpClient := &http.Client{}
+	if cfg.Gitlab.OAuth != nil {
+		var err error
+		httpClient, err = oauthHTTPClient(cfg.Gitlab.URL, cfg.Gitlab.OAuth)
+		if err != nil {
+			logger.WithFields(log.Fields{"err": err}).Error("failed to configure Gitlab OAuth client")
+			return nil, err
+		}
+		// The Authorization header set by the client is overridden by the OAuth transport with the current token.
+		newClient = gitlab.NewOAuthClient
+	}
+	httpClient.Transport = tracker.InstrumentRoundTripper(config.TrackerGitlab, httpClient.Transport)
+	opts = append(opts, gitlab.WithHTTPClient(httpClient))
+	cli, err := newClient(token, opts...)
 	if err != nil {
 		logger.WithFields(log.Fields{"err": err}).Error("failed to create Gitlab client")
 		return nil, err
 	}
 	g := &Gitlab{
-		client:             cli,
-		projectID:          projectID,
-		issueTemplate:      issueTemplate,
-		issueLabels:        issueLabels,
-		dynamicIssueLabels: dynamicIssueLabels,
-		groupInterval:      groupInterval,
-		logger:             logger,
+		client:          cli,
+		rootRoute:       cfg.Route,
+		closeOnResolve:  cfg.CloseOnResolve,
+		issueAppendMode: cfg.IssueAppendMode,
+		assignees:       cfg.Assignees,
+		userCache:       &userCache{ids: map[string]int{}},
+		severityLabel:   cfg.SeverityLabel,
+		severities:      cfg.Severities,
+		incident:        cfg.Incident,
+		logger:          logger,
 	}
 	if err := g.ping(); err != nil {
-		logger.WithFields(log.Fields{"url": url, "err": err}).Error("msg", "cannot reach the Gitlab")
+		logger.WithFields(log.Fields{"url": cfg.Gitlab.URL, "err": err}).Error("msg", "cannot reach the Gitlab")
 		return nil, err
 	}
 	return g, nil
@@ -55,190 +86,275 @@ func New(logger log.FieldLogger, url string, token string, projectID int, issueT
 
 // Gitlab holds configured Gitlab client and provides API for creating templated issue from the Webhook.
 type Gitlab struct {
-	client             *gitlab.Client
-	projectID          int
-	issueTemplate      *template.Template
-	issueLabels        *[]string
-	dynamicIssueLabels *[]string
-	groupInterval      *time.Duration
-	logger             log.FieldLogger
-}
-
-func (g *Gitlab) formatGitlabScopedLabel(key string, value string) string {
-	return fmt.Sprintf("%s::%s", key, value)
-}
-
-func (g *Gitlab) extractDynamicLabels(msg *alertmanager.Webhook) []string {
-	var labelsMap = map[string]string{}
-	for _, a := range msg.Alerts {
-		for k, v := range a.Labels {
-			for _, l := range *g.dynamicIssueLabels {
-				if k == l {
-					labelsMap[k] = v
-				}
-			}
-		}
-	}
-	var resLabels []string
-	for k, v := range labelsMap {
-		resLabels = append(resLabels, g.formatGitlabScopedLabel(k, v))
-	}
-	return resLabels
+	client          *gitlab.Client
+	rootRoute       *routing.Route
+	closeOnResolve  bool
+	issueAppendMode string
+	assignees       config.AssigneesConfig
+	userCache       *userCache
+	severityLabel   string
+	severities      map[string]config.SeverityConfig
+	incident        config.IncidentConfig
+	health          healthCache
+	logger          log.FieldLogger
 }
 
-func (g *Gitlab) extractGroupingLabels(msg *alertmanager.Webhook) []string {
-	var resLabels []string
-	for k, v := range msg.GroupLabels {
-		resLabels = append(resLabels, g.formatGitlabScopedLabel(k, v))
-	}
-	return resLabels
+func (g *Gitlab) getOpenIssuesSince(ctx context.Context, route *routing.Route, groupingLabels []string, sinceTime time.Time) ([]*gitlab.Issue, error) {
+	return g.listOpenIssues(ctx, route, groupingLabels, &sinceTime)
 }
 
-func (g *Gitlab) renderIssueTemplate(msg *alertmanager.Webhook) (*bytes.Buffer, error) {
-	var issueText bytes.Buffer
-	// Try to template the issue text template with the alert data.
-	if err := g.issueTemplate.Execute(&issueText, msg.Data); err != nil {
-		// As a fallback we try to add raw JSON of the alert to the issue text, so we don't miss an alert just because of template error.
-		metrics.ReportError("IssueTemplateError", "")
-		g.logger.WithFields(log.Fields{"err": err}).Error("failed to template issue text, using pure JSON instead")
-		w := bufio.NewWriter(&issueText)
-		_, err := w.WriteString("\n```json\n")
-		if err != nil {
-			metrics.ReportError("JSONWriteError", "")
-			g.logger.WithFields(log.Fields{"err": err}).Error("failed to write the alert to JSON")
-			return nil, err
-		}
-		e := json.NewEncoder(w)
-		e.SetIndent("", "    ")
-		if err := e.Encode(msg); err != nil {
-			// If even JSON marshalling fails we return error
-			metrics.ReportError("JSONMarshalError", "")
-			g.logger.WithFields(log.Fields{"err": err}).Error("failed to marshall alert to JSON")
-			return nil, err
-		}
-		_, err = w.WriteString("\n```\n")
-		if err != nil {
-			metrics.ReportError("JSONWriteError", "")
-			g.logger.WithFields(log.Fields{"err": err}).Error("failed to write the alert to JSON")
-			return nil, err
-		}
-		err = w.Flush()
-		if err != nil {
-			metrics.ReportError("JSONWriteError", "")
-			g.logger.WithFields(log.Fields{"err": err}).Error("failed to write the alert to JSON")
-			return nil, err
-		}
-	}
-	return &issueText, nil
+func (g *Gitlab) getAllOpenIssues(ctx context.Context, route *routing.Route, groupingLabels []string) ([]*gitlab.Issue, error) {
+	return g.listOpenIssues(ctx, route, groupingLabels, nil)
 }
 
-func (g *Gitlab) getOpenIssuesSince(groupingLabels []string, sinceTime time.Time) ([]*gitlab.Issue, error) {
+func (g *Gitlab) listOpenIssues(ctx context.Context, route *routing.Route, groupingLabels []string, sinceTime *time.Time) ([]*gitlab.Issue, error) {
+	logger := tracing.Logger(ctx, g.logger)
 	glLabels := gitlab.Labels(groupingLabels)
 	openState := "opened"
 	scope := "created_by_me"
 	orderBy := "created_at"
-	listOpts := gitlab.ListIssuesOptions{
+	listOpts := gitlab.ListProjectIssuesOptions{
 		Labels:       &glLabels,
-		CreatedAfter: &sinceTime,
+		CreatedAfter: sinceTime,
 		State:        &openState,
 		Scope:        &scope,
 		OrderBy:      &orderBy,
 	}
-	issues, response, err := g.client.Issues.ListIssues(&listOpts)
+	issues, response, err := g.client.Issues.ListProjectIssues(route.ProjectID(), &listOpts, gitlab.WithContext(ctx))
 	if err != nil {
 		metrics.ReportError("ListGitlabIssuesError", "gitlab")
-		g.logger.WithFields(log.Fields{"opts": listOpts, "response": response, "err": err}).Error("failed to list gitlab issues with")
+		logger.WithFields(log.Fields{"opts": listOpts, "response": response, "err": err}).Error("failed to list gitlab issues with")
 		return []*gitlab.Issue{}, err
 	}
 	return issues, nil
 }
 
-func (g *Gitlab) getTimeBefore(before *time.Duration) time.Time {
-	return time.Now().Local().Add(-*before)
+func (g *Gitlab) getTimeBefore(before time.Duration) time.Time {
+	return time.Now().Local().Add(-before)
 }
 
-func (g *Gitlab) createGitlabIssue(msg *alertmanager.Webhook, groupingLabels []string, issueText *bytes.Buffer) error {
+func (g *Gitlab) createGitlabIssue(ctx context.Context, route *routing.Route, msg *alertmanager.Webhook, groupingLabels []string, issueText *bytes.Buffer) error {
+	logger := tracing.Logger(ctx, g.logger)
 	// Collect all new issue labels
 	var labels gitlab.Labels = gitlab.Labels{}
-	labels = append(labels, *g.issueLabels...)
+	labels = append(labels, route.IssueLabels...)
 	labels = append(labels, groupingLabels...)
-	labels = append(labels, g.extractDynamicLabels(msg)...)
+	labels = append(labels, tracker.ExtractDynamicLabels(route, msg)...)
 	options := &gitlab.CreateIssueOptions{
-		Title:       gitlab.String(fmt.Sprintf("Firing alert `%s`", msg.CommonLabels["alertname"])),
+		Title:       gitlab.String(tracker.RenderIssueTitle(logger, route, msg)),
 		Description: gitlab.String(issueText.String()),
 		Labels:      &labels,
 	}
+	if assigneeIDs := g.getAssigneeIDs(ctx, msg); len(assigneeIDs) > 0 {
+		options.AssigneeIDs = &assigneeIDs
+	}
+	g.setSeverityFields(ctx, route, msg, options)
+	if g.incident.Enabled {
+		options.IssueType = gitlab.String(issueTypeIncident)
+	}
 
-	createdIssue, response, err := g.client.Issues.CreateIssue(g.projectID, options)
+	createdIssue, response, err := g.client.Issues.CreateIssue(route.ProjectID(), options, gitlab.WithContext(ctx))
 	if err != nil {
 		metrics.ReportError("FailedToCreateGitlabIssue", "gitlab")
-		g.logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to create gitlab issue")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to create gitlab issue")
+		return err
+	}
+	logger.WithFields(log.Fields{"gitlab_issue_id": createdIssue.IID, "project": route.Project, "alert_grouping_key": msg.GroupKey}).Info("created issue in gitlab")
+	tracker.ReportIssueAction(config.TrackerGitlab, tracker.IssueActionCreated)
+	if g.incident.Enabled {
+		g.setIncidentSeverity(ctx, route, msg, createdIssue)
+	}
+	return nil
+}
+
+// updateGitlabIssue appends the alert to the issue. In the note and discussion append modes, the note is added first
+// and the labels are updated only after it succeeds, so failed append does not leave the issue with the bumped labels.
+func (g *Gitlab) updateGitlabIssue(ctx context.Context, route *routing.Route, msg *alertmanager.Webhook, issue *gitlab.Issue, issueText *bytes.Buffer) error {
+	logger := tracing.Logger(ctx, g.logger)
+	switch g.issueAppendMode {
+	case config.AppendModeNote:
+		if err := g.createAppendNote(ctx, route, issue, issueText); err != nil {
+			return err
+		}
+	case config.AppendModeDiscussion:
+		if err := g.addAppendDiscussionNote(ctx, route, issue, issueText); err != nil {
+			return err
+		}
+	}
+	newLabels := gitlab.Labels(tracker.IncreaseAppendLabel(logger, issue.Labels))
+	options := &gitlab.UpdateIssueOptions{
+		Labels: &newLabels,
+	}
+	if g.issueAppendMode == config.AppendModeDescription {
+		// Concat original description with the new rendered template separated by `Appended on <date>` statement
+		options.Description = gitlab.String(fmt.Sprintf("%s\n\n%s", issue.Description, tracker.FormatAppendedText(issueText)))
+	}
+	updatedIssue, response, err := g.client.Issues.UpdateIssue(route.ProjectID(), issue.IID, options, gitlab.WithContext(ctx))
+	if err != nil {
+		metrics.ReportError("FailedToUpdateGitlabIssue", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to update gitlab issue")
 		return err
 	}
-	g.logger.WithFields(log.Fields{"gitlab_issue_id": createdIssue.IID, "alert_grouping_key": msg.GroupKey}).Info("created issue in gitlab")
+	logger.WithFields(log.Fields{"gitlab_issue_id": updatedIssue.IID, "project": route.Project, "append_mode": g.issueAppendMode}).Info("updated issue in gitlab")
+	tracker.ReportIssueAction(config.TrackerGitlab, tracker.IssueActionUpdated)
+	g.addTimelineEvent(ctx, msg, issue)
 	return nil
 }
 
-func (g *Gitlab) increaseAppendLabel(labels []string) []string {
-	// Every updated issue has special label containing number of updates
-	appendLabelRegex := regexp.MustCompile(`(appended-alerts)::(\d+)`)
-	alreadyAppended := false
-	var newLabels []string
-	for _, l := range labels {
-		// Check if the label is the special one
-		matched := appendLabelRegex.FindStringSubmatch(l)
-		if len(matched) == 3 {
-			alreadyAppended = true
-			// Convert it to number if possible otherwise leave the old one as is
-			count, err := strconv.Atoi(matched[2])
-			if err != nil {
-				g.logger.WithFields(log.Fields{"err": err, "label_value": l}).Error("failed to parse gitlab issue label `appended-alerts`, leaving it unmodified")
-				newLabels = append(newLabels, l)
-				continue
+func (g *Gitlab) createAppendNote(ctx context.Context, route *routing.Route, issue *gitlab.Issue, issueText *bytes.Buffer) error {
+	logger := tracing.Logger(ctx, g.logger)
+	options := &gitlab.CreateIssueNoteOptions{
+		Body: gitlab.String(tracker.FormatAppendedText(issueText)),
+	}
+	_, response, err := g.client.Notes.CreateIssueNote(route.ProjectID(), issue.IID, options, gitlab.WithContext(ctx))
+	if err != nil {
+		metrics.ReportError("FailedToCreateGitlabIssueNote", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to add appended alert as note to gitlab issue")
+		return err
+	}
+	return nil
+}
+
+// appendDiscussionMarker identifies the discussion thread the appended alerts are added to as replies.
+const appendDiscussionMarker = "<!-- prometheus-gitlab-notifier:appended-alerts -->"
+
+func (g *Gitlab) findAppendDiscussion(ctx context.Context, route *routing.Route, issue *gitlab.Issue) (*gitlab.Discussion, error) {
+	logger := tracing.Logger(ctx, g.logger)
+	options := &gitlab.ListIssueDiscussionsOptions{PerPage: 100, Page: 1}
+	for {
+		discussions, response, err := g.client.Discussions.ListIssueDiscussions(route.ProjectID(), issue.IID, options, gitlab.WithContext(ctx))
+		if err != nil {
+			metrics.ReportError("FailedToListGitlabIssueDiscussions", "gitlab")
+			logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to list gitlab issue discussions")
+			return nil, err
+		}
+		for _, d := range discussions {
+			if len(d.Notes) > 0 && strings.HasPrefix(d.Notes[0].Body, appendDiscussionMarker) {
+				return d, nil
 			}
-			// Increase the number of appends and add override the old label with it
-			newLabels = append(newLabels, g.formatGitlabScopedLabel(matched[1], strconv.Itoa(count+1)))
-			continue
 		}
-		newLabels = append(newLabels, l)
+		if response.NextPage == 0 {
+			return nil, nil
+		}
+		options.Page = response.NextPage
+	}
+}
+
+func (g *Gitlab) addAppendDiscussionNote(ctx context.Context, route *routing.Route, issue *gitlab.Issue, issueText *bytes.Buffer) error {
+	logger := tracing.Logger(ctx, g.logger)
+	discussion, err := g.findAppendDiscussion(ctx, route, issue)
+	if err != nil {
+		return err
+	}
+	if discussion == nil {
+		// First appended alert starts the discussion thread.
+		options := &gitlab.CreateIssueDiscussionOptions{
+			Body: gitlab.String(fmt.Sprintf("%s\n%s", appendDiscussionMarker, tracker.FormatAppendedText(issueText))),
+		}
+		_, response, err := g.client.Discussions.CreateIssueDiscussion(route.ProjectID(), issue.IID, options, gitlab.WithContext(ctx))
+		if err != nil {
+			metrics.ReportError("FailedToCreateGitlabIssueDiscussion", "gitlab")
+			logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to create discussion of appended alerts in gitlab issue")
+			return err
+		}
+		return nil
 	}
-	if !alreadyAppended {
-		newLabels = append(newLabels, g.formatGitlabScopedLabel("appended-alerts", "1"))
+	options := &gitlab.AddIssueDiscussionNoteOptions{
+		Body: gitlab.String(tracker.FormatAppendedText(issueText)),
 	}
-	return newLabels
+	_, response, err := g.client.Discussions.AddIssueDiscussionNote(route.ProjectID(), issue.IID, discussion.ID, options, gitlab.WithContext(ctx))
+	if err != nil {
+		metrics.ReportError("FailedToAddGitlabIssueDiscussionNote", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to add appended alert to discussion of gitlab issue")
+		return err
+	}
+	return nil
 }
 
-func (g *Gitlab) updateGitlabIssue(issue *gitlab.Issue, issueText *bytes.Buffer) error {
-	newLabels := gitlab.Labels(g.increaseAppendLabel(issue.Labels))
+func (g *Gitlab) resolveGitlabIssue(ctx context.Context, route *routing.Route, msg *alertmanager.Webhook, issue *gitlab.Issue, issueText *bytes.Buffer, closeIssue bool) error {
+	logger := tracing.Logger(ctx, g.logger)
+	noteOptions := &gitlab.CreateIssueNoteOptions{
+		Body: gitlab.String(tracker.FormatResolvedText(issueText)),
+	}
+	_, response, err := g.client.Notes.CreateIssueNote(route.ProjectID(), issue.IID, noteOptions, gitlab.WithContext(ctx))
+	if err != nil {
+		metrics.ReportError("FailedToCreateGitlabIssueNote", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to add resolution note to gitlab issue")
+		return err
+	}
+	logger.WithFields(log.Fields{"gitlab_issue_id": issue.IID, "project": route.Project}).Info("added resolution note to issue in gitlab")
+	tracker.ReportIssueAction(config.TrackerGitlab, tracker.IssueActionResolved)
+	g.addTimelineEvent(ctx, msg, issue)
+	if !closeIssue {
+		return nil
+	}
 	options := &gitlab.UpdateIssueOptions{
-		// Concat original description with the new rendered template separated by `Appended on <date>` statement
-		Description: gitlab.String(fmt.Sprintf("%s\n\n_Appended on `%s`_\n%s", issue.Description, time.Now().Local(), issueText.String())),
-		Labels:      &newLabels,
+		StateEvent: gitlab.String("close"),
 	}
-	issue, response, err := g.client.Issues.UpdateIssue(g.projectID, issue.IID, options)
+	_, response, err = g.client.Issues.UpdateIssue(route.ProjectID(), issue.IID, options, gitlab.WithContext(ctx))
 	if err != nil {
-		metrics.ReportError("FailedToUpdateGitlabIssue", "gitlab")
-		g.logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to update gitlab issue, will try to create new")
+		metrics.ReportError("FailedToCloseGitlabIssue", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to close gitlab issue")
 		return err
 	}
-	g.logger.WithFields(log.Fields{"gitlab_issue_id": issue.IID}).Info("updated issue in gitlab")
+	logger.WithFields(log.Fields{"gitlab_issue_id": issue.IID, "project": route.Project}).Info("closed issue in gitlab")
+	tracker.ReportIssueAction(config.TrackerGitlab, tracker.IssueActionClosed)
 	return nil
 }
 
+// resolveIssues adds resolution note to all open issues matching the resolved Webhook and closes them if configured to.
+func (g *Gitlab) resolveIssues(ctx context.Context, route *routing.Route, msg *alertmanager.Webhook, groupingLabels []string) error {
+	logger := tracing.Logger(ctx, g.logger)
+	// The issue could have been opened long before the group interval, so look for any open issue.
+	matchingIssues, err := g.getAllOpenIssues(ctx, route, groupingLabels)
+	if err != nil {
+		return err
+	}
+	if len(matchingIssues) == 0 {
+		logger.WithField("alert_grouping_key", msg.GroupKey).Info("no open issue found for the resolved alert, nothing to do")
+		return nil
+	}
+
+	issueText, err := tracker.RenderIssueTemplate(logger, route, msg)
+	if err != nil {
+		return err
+	}
+
+	closeIssue := g.closeOnResolve && tracker.AllAlertsResolved(msg)
+	var lastErr error
+	for _, issue := range matchingIssues {
+		if err := g.resolveGitlabIssue(ctx, route, msg, issue, issueText, closeIssue); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
 // CreateIssue from the Webhook in Gitlab
-func (g *Gitlab) CreateIssue(msg *alertmanager.Webhook) error {
+func (g *Gitlab) CreateIssue(ctx context.Context, msg *alertmanager.Webhook) (err error) {
+	ctx, span := tracing.Start(ctx, "Gitlab.CreateIssue", trace.WithAttributes(attribute.String("alert_grouping_key", msg.GroupKey)))
+	defer func() { tracing.EndSpan(span, err) }()
+	logger := tracing.Logger(ctx, g.logger)
+	// Find out where and how to create the issue
+	route := g.rootRoute.Match(msg)
+	logger.WithFields(log.Fields{"alert_grouping_key": msg.GroupKey, "project": route.Project}).Debug("routed alert to project")
+
 	// Extract grouping labels from the message
-	groupingLabels := g.extractGroupingLabels(msg)
-	groupingLabels = append(groupingLabels, *g.issueLabels...)
+	groupingLabels := tracker.ExtractGroupingLabels(msg)
+	groupingLabels = append(groupingLabels, route.IssueLabels...)
+
+	if msg.Status == string(model.AlertResolved) {
+		return g.resolveIssues(ctx, route, msg, groupingLabels)
+	}
 
 	// Check for existing issues with same grouping labels
-	matchingIssues, err := g.getOpenIssuesSince(groupingLabels, g.getTimeBefore(g.groupInterval))
+	matchingIssues, err := g.getOpenIssuesSince(ctx, route, groupingLabels, g.getTimeBefore(time.Duration(route.GroupInterval)))
 	if err != nil {
-		g.logger.Warn("listing of open issues to check for duplicates failed , opening a new one even though possible duplicate")
+		logger.Warn("listing of open issues to check for duplicates failed , opening a new one even though possible duplicate")
 	}
 
 	// Try to render the issue text template
-	issueText, err := g.renderIssueTemplate(msg)
+	issueText, err := tracker.RenderIssueTemplate(logger, route, msg)
 	if err != nil {
 		return err
 	}
@@ -246,23 +362,33 @@ func (g *Gitlab) CreateIssue(msg *alertmanager.Webhook) error {
 	if len(matchingIssues) > 0 {
 		// Issues are ordered by created date, we update the first so the newest one.
 		issueToUpdate := matchingIssues[0]
-		if err := g.updateGitlabIssue(issueToUpdate, issueText); err != nil {
-			g.logger.WithField("updated_issue_id", issueToUpdate.IID).Warn("updating an existing issue failed, opening a new one")
-		} else {
+		err := g.updateGitlabIssue(ctx, route, msg, issueToUpdate, issueText)
+		if err == nil {
 			return nil
 		}
+		if g.issueAppendMode != config.AppendModeDescription {
+			// The alert may be already appended as note, so it is retried instead of opening a duplicate issue.
+			logger.WithField("updated_issue_id", issueToUpdate.IID).Warn("appending to an existing issue failed, the alert will be retried")
+			return err
+		}
+		logger.WithField("updated_issue_id", issueToUpdate.IID).Warn("updating an existing issue failed, opening a new one")
 	}
 	// Try to create a new issue rather than discarding it after failed update.
-	return g.createGitlabIssue(msg, groupingLabels, issueText)
+	return g.createGitlabIssue(ctx, route, msg, groupingLabels, issueText)
 }
 
+// pingTimeout limits the ping done on each config reload, so unresponsive Gitlab does not block the reload.
+const pingTimeout = 5 * time.Second
+
 func (g *Gitlab) ping() error {
 	g.logger.WithField("url", g.client.BaseURL()).Debug("trying to ping gitlab")
-	_, err := http.Head(g.client.BaseURL().String())
+	client := &http.Client{Timeout: pingTimeout}
+	resp, err := client.Head(g.client.BaseURL().String())
 	if err != nil {
 		metrics.ReportError("FailedToPingGitlab", "gitlab")
 		g.logger.WithField("err", err).Error("failed to ping gitlab with HEAD request")
 		return err
 	}
+	resp.Body.Close()
 	return nil
 }
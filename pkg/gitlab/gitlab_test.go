@@ -0,0 +1,365 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/issuetemplate"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/time/rate"
+)
+
+// apiRequest is a request received by the fakeGitlab.
+type apiRequest struct {
+	method string
+	path   string
+	query  url.Values
+	body   map[string]interface{}
+}
+
+// fakeGitlab is a Gitlab API recording the requests and responding with the configured responses.
+// Requests without a configured response get 404, the same as Gitlab for missing resources.
+type fakeGitlab struct {
+	mtx       sync.Mutex
+	requests  []apiRequest
+	responses map[string]string
+	statuses  map[string]int
+}
+
+func (f *fakeGitlab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	req := apiRequest{method: r.Method, path: r.URL.Path, query: r.URL.Query()}
+	if body, _ := io.ReadAll(r.Body); len(body) > 0 {
+		_ = json.Unmarshal(body, &req.body)
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.requests = append(f.requests, req)
+	key := r.Method + " " + r.URL.Path
+	if status, ok := f.statuses[key]; ok {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"message":"failed"}`))
+		return
+	}
+	response, ok := f.responses[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"404 Not Found"}`))
+		return
+	}
+	_, _ = w.Write([]byte(response))
+}
+
+// recorded returns "METHOD path" of all the received requests.
+func (f *fakeGitlab) recorded() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var res []string
+	for _, r := range f.requests {
+		res = append(res, r.method+" "+r.path)
+	}
+	return res
+}
+
+// request returns the last received request with the method and path.
+func (f *fakeGitlab) request(t *testing.T, method string, path string) apiRequest {
+	t.Helper()
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].method == method && f.requests[i].path == path {
+			return f.requests[i]
+		}
+	}
+	t.Fatalf("no %s %s request received", method, path)
+	return apiRequest{}
+}
+
+func newTestGitlab(t *testing.T, fake *fakeGitlab) *Gitlab {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	cli, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL), gitlab.WithCustomLimiter(rate.NewLimiter(rate.Inf, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := issuetemplate.Parse("issue", "Alert {{ .CommonLabels.alertname }}", issuetemplate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New()
+	logger.Out = io.Discard
+	return &Gitlab{
+		client:          cli,
+		rootRoute:       &routing.Route{Project: "1", IssueLabels: []string{"alert"}, GroupInterval: model.Duration(time.Hour), IssueTemplate: tpl},
+		issueAppendMode: config.AppendModeDescription,
+		userCache:       &userCache{ids: map[string]int{}},
+		severityLabel:   "severity",
+		logger:          logger,
+	}
+}
+
+func testWebhook(status string, alertStatuses ...string) *alertmanager.Webhook {
+	var alerts template.Alerts
+	for _, s := range alertStatuses {
+		alerts = append(alerts, template.Alert{Status: s, Labels: template.KV{"alertname": "Foo"}})
+	}
+	return alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{
+		Data: &template.Data{
+			Status:       status,
+			Alerts:       alerts,
+			GroupLabels:  template.KV{"alertname": "Foo"},
+			CommonLabels: template.KV{"alertname": "Foo"},
+		},
+		GroupKey: "{}:{alertname=\"Foo\"}",
+	})
+}
+
+const (
+	issuesPath = "/api/v4/projects/1/issues"
+	issuePath  = "/api/v4/projects/1/issues/1"
+	notesPath  = "/api/v4/projects/1/issues/1/notes"
+	openIssue  = `[{"id":10,"iid":1,"labels":["alert","alertname::Foo"],"description":"Alert Foo"}]`
+)
+
+func TestCreateNewIssue(t *testing.T) {
+	fake := &fakeGitlab{responses: map[string]string{
+		"GET " + issuesPath:  `[]`,
+		"POST " + issuesPath: `{"id":10,"iid":1}`,
+	}}
+	g := newTestGitlab(t, fake)
+	if err := g.CreateIssue(context.Background(), testWebhook("firing", "firing")); err != nil {
+		t.Fatal(err)
+	}
+	list := fake.request(t, http.MethodGet, issuesPath)
+	if got := list.query.Get("labels"); got != "alertname::Foo,alert" {
+		t.Errorf("expected open issues listed by the grouping labels, got %q", got)
+	}
+	if list.query.Get("state") != "opened" || list.query.Get("created_after") == "" {
+		t.Errorf("expected only issues opened within the group interval listed, got query %v", list.query)
+	}
+	created := fake.request(t, http.MethodPost, issuesPath)
+	if created.body["title"] != "Firing alert `Foo`" {
+		t.Errorf("expected default title, got %v", created.body["title"])
+	}
+	if created.body["description"] != "Alert Foo" {
+		t.Errorf("expected rendered description, got %v", created.body["description"])
+	}
+	labels, _ := created.body["labels"].(string)
+	for _, l := range []string{"alert", "alertname::Foo"} {
+		if !strings.Contains(","+labels+",", ","+l+",") {
+			t.Errorf("expected label %s in the issue labels %q", l, labels)
+		}
+	}
+}
+
+func TestResolveIssue(t *testing.T) {
+	tests := []struct {
+		name             string
+		closeOnResolve   bool
+		openIssues       string
+		alertStatuses    []string
+		expectedRequests []string
+	}{
+		{
+			name:             "resolved alert is commented",
+			openIssues:       openIssue,
+			alertStatuses:    []string{"resolved"},
+			expectedRequests: []string{"GET " + issuesPath, "POST " + notesPath},
+		},
+		{
+			name:             "resolved alert closes the issue",
+			closeOnResolve:   true,
+			openIssues:       openIssue,
+			alertStatuses:    []string{"resolved", "resolved"},
+			expectedRequests: []string{"GET " + issuesPath, "POST " + notesPath, "PUT " + issuePath},
+		},
+		{
+			name:             "issue is not closed while some alert is firing",
+			closeOnResolve:   true,
+			openIssues:       openIssue,
+			alertStatuses:    []string{"resolved", "firing"},
+			expectedRequests: []string{"GET " + issuesPath, "POST " + notesPath},
+		},
+		{
+			name:             "nothing to do without open issue",
+			closeOnResolve:   true,
+			openIssues:       `[]`,
+			alertStatuses:    []string{"resolved"},
+			expectedRequests: []string{"GET " + issuesPath},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGitlab{responses: map[string]string{
+				"GET " + issuesPath: tt.openIssues,
+				"POST " + notesPath: `{"id":1}`,
+				"PUT " + issuePath:  `{"id":10,"iid":1}`,
+			}}
+			g := newTestGitlab(t, fake)
+			g.closeOnResolve = tt.closeOnResolve
+			if err := g.CreateIssue(context.Background(), testWebhook("resolved", tt.alertStatuses...)); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.recorded(); strings.Join(got, "\n") != strings.Join(tt.expectedRequests, "\n") {
+				t.Fatalf("expected requests %v, got %v", tt.expectedRequests, got)
+			}
+			list := fake.request(t, http.MethodGet, issuesPath)
+			if list.query.Get("created_after") != "" {
+				t.Errorf("expected all open issues listed regardless of the group interval, got query %v", list.query)
+			}
+			if tt.openIssues == `[]` {
+				return
+			}
+			note := fake.request(t, http.MethodPost, notesPath)
+			if body, _ := note.body["body"].(string); !strings.HasPrefix(body, "_Resolved on") || !strings.HasSuffix(body, "Alert Foo") {
+				t.Errorf("expected resolution note with the rendered alert, got %q", body)
+			}
+			if tt.closeOnResolve && len(tt.expectedRequests) == 3 {
+				if got := fake.request(t, http.MethodPut, issuePath).body["state_event"]; got != "close" {
+					t.Errorf("expected the issue closed, got state event %v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestAppendToExistingIssue(t *testing.T) {
+	const (
+		discussionsPath    = "/api/v4/projects/1/issues/1/discussions"
+		discussionNotePath = "/api/v4/projects/1/issues/1/discussions/abc/notes"
+		appendedIssue      = `[{"id":10,"iid":1,"labels":["alert","alertname::Foo","appended-alerts::2"],"description":"Alert Foo"}]`
+	)
+	tests := []struct {
+		name             string
+		appendMode       string
+		discussions      string
+		failing          string
+		expectError      bool
+		expectedRequests []string
+		appendedTo       string
+	}{
+		{
+			name:             "description mode rewrites the description",
+			appendMode:       config.AppendModeDescription,
+			expectedRequests: []string{"GET " + issuesPath, "PUT " + issuePath},
+		},
+		{
+			name:             "note mode adds note before updating labels",
+			appendMode:       config.AppendModeNote,
+			expectedRequests: []string{"GET " + issuesPath, "POST " + notesPath, "PUT " + issuePath},
+			appendedTo:       "POST " + notesPath,
+		},
+		{
+			name:             "discussion mode starts the discussion",
+			appendMode:       config.AppendModeDiscussion,
+			discussions:      `[{"id":"xyz","notes":[{"body":"unrelated comment"}]}]`,
+			expectedRequests: []string{"GET " + issuesPath, "GET " + discussionsPath, "POST " + discussionsPath, "PUT " + issuePath},
+			appendedTo:       "POST " + discussionsPath,
+		},
+		{
+			name:             "discussion mode replies to the existing discussion",
+			appendMode:       config.AppendModeDiscussion,
+			discussions:      `[{"id":"abc","notes":[{"body":"` + appendDiscussionMarker + `\nfirst"}]}]`,
+			expectedRequests: []string{"GET " + issuesPath, "GET " + discussionsPath, "POST " + discussionNotePath, "PUT " + issuePath},
+			appendedTo:       "POST " + discussionNotePath,
+		},
+		{
+			name:             "failed note is retried without bumping labels or opening new issue",
+			appendMode:       config.AppendModeNote,
+			failing:          "POST " + notesPath,
+			expectError:      true,
+			expectedRequests: []string{"GET " + issuesPath, "POST " + notesPath},
+		},
+		{
+			name:             "failed description update opens new issue",
+			appendMode:       config.AppendModeDescription,
+			failing:          "PUT " + issuePath,
+			expectedRequests: []string{"GET " + issuesPath, "PUT " + issuePath, "POST " + issuesPath},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGitlab{
+				responses: map[string]string{
+					"GET " + issuesPath:          appendedIssue,
+					"POST " + issuesPath:         `{"id":11,"iid":2}`,
+					"PUT " + issuePath:           `{"id":10,"iid":1}`,
+					"POST " + notesPath:          `{"id":1}`,
+					"GET " + discussionsPath:     tt.discussions,
+					"POST " + discussionsPath:    `{"id":"xyz"}`,
+					"POST " + discussionNotePath: `{"id":2}`,
+				},
+				statuses: map[string]int{},
+			}
+			if tt.failing != "" {
+				fake.statuses[tt.failing] = http.StatusForbidden
+			}
+			g := newTestGitlab(t, fake)
+			g.issueAppendMode = tt.appendMode
+			err := g.CreateIssue(context.Background(), testWebhook("firing", "firing"))
+			if tt.expectError != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			if got := fake.recorded(); strings.Join(got, "\n") != strings.Join(tt.expectedRequests, "\n") {
+				t.Fatalf("expected requests %v, got %v", tt.expectedRequests, got)
+			}
+			if tt.failing != "" {
+				return
+			}
+			update := fake.request(t, http.MethodPut, issuePath)
+			if got := update.body["labels"]; got != "alert,alertname::Foo,appended-alerts::3" {
+				t.Errorf("expected appended alerts label bumped, got %v", got)
+			}
+			description, hasDescription := update.body["description"].(string)
+			if tt.appendMode == config.AppendModeDescription {
+				if !strings.HasPrefix(description, "Alert Foo\n\n_Appended on") || !strings.HasSuffix(description, "Alert Foo") {
+					t.Errorf("expected alert appended to the original description, got %q", description)
+				}
+				return
+			}
+			if hasDescription {
+				t.Errorf("expected description unchanged, got %q", description)
+			}
+			method, path, _ := strings.Cut(tt.appendedTo, " ")
+			body, _ := fake.request(t, method, path).body["body"].(string)
+			if !strings.Contains(body, "_Appended on") || !strings.HasSuffix(body, "Alert Foo") {
+				t.Errorf("expected appended alert in the comment, got %q", body)
+			}
+			if path == discussionsPath && !strings.HasPrefix(body, appendDiscussionMarker) {
+				t.Errorf("expected new discussion marked to be found by the later alerts, got %q", body)
+			}
+		})
+	}
+}
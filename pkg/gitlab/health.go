@@ -0,0 +1,56 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/xanzy/go-gitlab"
+)
+
+// healthCacheDuration is how long the result of the health check is cached, so frequent probes do not load the Gitlab.
+const healthCacheDuration = 30 * time.Second
+
+// healthCheckTimeout limits the health check request, so the probes waiting for the cached result are not blocked by unresponsive Gitlab.
+const healthCheckTimeout = 5 * time.Second
+
+type healthCache struct {
+	mtx       sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// CheckHealth checks the Gitlab is reachable and the token is valid using the current user API.
+// The result is cached for healthCacheDuration.
+func (g *Gitlab) CheckHealth() error {
+	g.health.mtx.Lock()
+	defer g.health.mtx.Unlock()
+	if time.Since(g.health.checkedAt) < healthCacheDuration {
+		return g.health.err
+	}
+	g.health.err = nil
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	if _, _, err := g.client.Users.CurrentUser(gitlab.WithContext(ctx)); err != nil {
+		metrics.ReportError("FailedToCheckGitlabHealth", "gitlab")
+		g.logger.WithField("err", err).Warn("gitlab health check failed")
+		g.health.err = fmt.Errorf("failed to get current gitlab user: %w", err)
+	}
+	g.health.checkedAt = time.Now()
+	return g.health.err
+}
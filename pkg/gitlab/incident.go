@@ -0,0 +1,169 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	issueTypeIncident = "incident"
+	// Gitlab limits length of the timeline event note in characters.
+	maxTimelineEventNoteLength = 280
+)
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphqlResponse struct {
+	Data map[string]struct {
+		Errors []string `json:"errors"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphql runs the GraphQL mutation for features not available in the REST API.
+func (g *Gitlab) graphql(ctx context.Context, query string, variables map[string]interface{}) error {
+	graphqlURL := *g.client.BaseURL()
+	graphqlURL.Path = strings.TrimSuffix(strings.TrimSuffix(graphqlURL.Path, "/"), "/v4") + "/graphql"
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, graphqlURL.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	var res graphqlResponse
+	if _, err := g.client.Do(req, &res); err != nil {
+		return err
+	}
+	var errs []string
+	for _, e := range res.Errors {
+		errs = append(errs, e.Message)
+	}
+	for _, d := range res.Data {
+		errs = append(errs, d.Errors...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("graphql request failed: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func (g *Gitlab) incidentSeverity(msg *alertmanager.Webhook) string {
+	if severity, ok := g.incident.SeverityMapping[msg.CommonLabels[g.severityLabel]]; ok {
+		return severity
+	}
+	return "UNKNOWN"
+}
+
+func (g *Gitlab) projectPath(ctx context.Context, route *routing.Route, issue *gitlab.Issue) (string, error) {
+	logger := tracing.Logger(ctx, g.logger)
+	if issue.References != nil && strings.Contains(issue.References.Full, "#") {
+		return issue.References.Full[:strings.LastIndex(issue.References.Full, "#")], nil
+	}
+	project, response, err := g.client.Projects.GetProject(route.ProjectID(), nil, gitlab.WithContext(ctx))
+	if err != nil {
+		metrics.ReportError("FailedToGetGitlabProject", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to get gitlab project")
+		return "", err
+	}
+	return project.PathWithNamespace, nil
+}
+
+// setIncidentSeverity sets severity of the created incident. Failure is only logged, since the incident is already created.
+func (g *Gitlab) setIncidentSeverity(ctx context.Context, route *routing.Route, msg *alertmanager.Webhook, issue *gitlab.Issue) {
+	logger := tracing.Logger(ctx, g.logger)
+	severity := g.incidentSeverity(msg)
+	projectPath, err := g.projectPath(ctx, route, issue)
+	if err != nil {
+		logger.WithFields(log.Fields{"err": err, "gitlab_issue_id": issue.IID}).Warn("failed to set incident severity")
+		return
+	}
+	err = g.graphql(ctx, `mutation($projectPath: ID!, $iid: String!, $severity: IssuableSeverity!) {
+  issueSetSeverity(input: {projectPath: $projectPath, iid: $iid, severity: $severity}) { errors }
+}`, map[string]interface{}{"projectPath": projectPath, "iid": fmt.Sprint(issue.IID), "severity": severity})
+	if err != nil {
+		metrics.ReportError("FailedToSetGitlabIncidentSeverity", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "gitlab_issue_id": issue.IID}).Warn("failed to set incident severity")
+		return
+	}
+	logger.WithFields(log.Fields{"gitlab_issue_id": issue.IID, "severity": severity}).Debug("set incident severity")
+}
+
+func (g *Gitlab) timelineEventNote(msg *alertmanager.Webhook) string {
+	var alertNames = map[string]struct{}{}
+	for _, a := range msg.Alerts {
+		alertNames[a.Labels[model.AlertNameLabel]] = struct{}{}
+	}
+	var names []string
+	for n := range alertNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var note string
+	if msg.Status == string(model.AlertResolved) {
+		note = fmt.Sprintf("Resolved %d alerts: %s", len(msg.Alerts), strings.Join(names, ", "))
+	} else {
+		note = fmt.Sprintf("Firing %d alerts: %s", len(msg.Alerts.Firing()), strings.Join(names, ", "))
+	}
+	// Truncate by characters, so multi-byte characters of the alert names are not cut in half.
+	if runes := []rune(note); len(runes) > maxTimelineEventNoteLength {
+		note = string(runes[:maxTimelineEventNoteLength-3]) + "..."
+	}
+	return note
+}
+
+// addTimelineEvent adds the alert as timeline event of the incident. Failure is only logged, since the alert is already in the issue.
+func (g *Gitlab) addTimelineEvent(ctx context.Context, msg *alertmanager.Webhook, issue *gitlab.Issue) {
+	logger := tracing.Logger(ctx, g.logger)
+	if !g.incident.Enabled || !g.incident.TimelineEvents || issue.IssueType == nil || *issue.IssueType != issueTypeIncident {
+		return
+	}
+	err := g.graphql(ctx, `mutation($incidentId: IssueID!, $note: String!, $occurredAt: Time!) {
+  timelineEventCreate(input: {incidentId: $incidentId, note: $note, occurredAt: $occurredAt}) { errors }
+}`, map[string]interface{}{
+		"incidentId": fmt.Sprintf("gid://gitlab/Issue/%d", issue.ID),
+		"note":       g.timelineEventNote(msg),
+		"occurredAt": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		metrics.ReportError("FailedToCreateGitlabTimelineEvent", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "gitlab_issue_id": issue.IID}).Warn("failed to add incident timeline event")
+		return
+	}
+	logger.WithField("gitlab_issue_id", issue.IID).Debug("added incident timeline event")
+}
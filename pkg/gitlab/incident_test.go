@@ -0,0 +1,178 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestTimelineEventNote(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		alerts   template.Alerts
+		expected string
+	}{
+		{
+			name:     "firing alerts",
+			status:   "firing",
+			alerts:   template.Alerts{{Status: "firing", Labels: template.KV{"alertname": "B"}}, {Status: "firing", Labels: template.KV{"alertname": "A"}}, {Status: "resolved", Labels: template.KV{"alertname": "A"}}},
+			expected: "Firing 2 alerts: A, B",
+		},
+		{
+			name:     "resolved alerts",
+			status:   "resolved",
+			alerts:   template.Alerts{{Status: "resolved", Labels: template.KV{"alertname": "A"}}, {Status: "resolved", Labels: template.KV{"alertname": "A"}}},
+			expected: "Resolved 2 alerts: A",
+		},
+		{
+			name:     "long note is truncated",
+			status:   "firing",
+			alerts:   template.Alerts{{Status: "firing", Labels: template.KV{"alertname": strings.Repeat("a", 300)}}},
+			expected: "Firing 1 alerts: " + strings.Repeat("a", maxTimelineEventNoteLength-3-len("Firing 1 alerts: ")) + "...",
+		},
+		{
+			name:     "long note is truncated by characters",
+			status:   "firing",
+			alerts:   template.Alerts{{Status: "firing", Labels: template.KV{"alertname": strings.Repeat("ř", 300)}}},
+			expected: "Firing 1 alerts: " + strings.Repeat("ř", maxTimelineEventNoteLength-3-len("Firing 1 alerts: ")) + "...",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Gitlab{}
+			msg := alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{Data: &template.Data{Status: tt.status, Alerts: tt.alerts}})
+			got := g.timelineEventNote(msg)
+			if got != tt.expected {
+				t.Errorf("expected note %q, got %q", tt.expected, got)
+			}
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) > maxTimelineEventNoteLength {
+				t.Errorf("expected valid note of at most %d characters, got %d", maxTimelineEventNoteLength, utf8.RuneCountInString(got))
+			}
+		})
+	}
+}
+
+func TestIncidentSeverity(t *testing.T) {
+	tests := []struct {
+		name     string
+		severity string
+		expected string
+	}{
+		{name: "mapped severity", severity: "critical", expected: "CRITICAL"},
+		{name: "custom mapping", severity: "page", expected: "HIGH"},
+		{name: "unknown severity", severity: "debug", expected: "UNKNOWN"},
+		{name: "missing severity", expected: "UNKNOWN"},
+	}
+	mapping := map[string]string{"page": "HIGH"}
+	for k, v := range config.DefaultIncidentSeverityMapping {
+		mapping[k] = v
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Gitlab{severityLabel: "severity", incident: config.IncidentConfig{SeverityMapping: mapping}}
+			msg := alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{Data: &template.Data{CommonLabels: template.KV{"severity": tt.severity}}})
+			if got := g.incidentSeverity(msg); got != tt.expected {
+				t.Errorf("expected incident severity %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+const graphqlPath = "/api/graphql"
+
+func TestCreateIncident(t *testing.T) {
+	fake := &fakeGitlab{responses: map[string]string{
+		"GET " + issuesPath:   `[]`,
+		"POST " + issuesPath:  `{"id":10,"iid":1,"issue_type":"incident","references":{"full":"group/project#1"}}`,
+		"POST " + graphqlPath: `{"data":{"issueSetSeverity":{"errors":[]}}}`,
+	}}
+	g := newTestGitlab(t, fake)
+	g.incident = config.IncidentConfig{Enabled: true, SeverityMapping: config.DefaultIncidentSeverityMapping}
+	msg := testWebhook("firing", "firing")
+	msg.CommonLabels["severity"] = "critical"
+	if err := g.CreateIssue(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.request(t, http.MethodPost, issuesPath).body["issue_type"]; got != issueTypeIncident {
+		t.Errorf("expected issue created as incident, got issue type %v", got)
+	}
+	mutation := fake.request(t, http.MethodPost, graphqlPath).body
+	if query, _ := mutation["query"].(string); !strings.Contains(query, "issueSetSeverity") {
+		t.Errorf("expected severity set by the issueSetSeverity mutation, got %q", query)
+	}
+	variables, _ := mutation["variables"].(map[string]interface{})
+	if variables["projectPath"] != "group/project" || variables["iid"] != "1" || variables["severity"] != "CRITICAL" {
+		t.Errorf("expected severity CRITICAL set for group/project#1, got variables %v", variables)
+	}
+}
+
+func TestIncidentTimelineEvent(t *testing.T) {
+	tests := []struct {
+		name           string
+		timelineEvents bool
+		issueType      string
+		status         string
+		expectEvent    bool
+	}{
+		{name: "appended alert adds event", timelineEvents: true, issueType: issueTypeIncident, status: "firing", expectEvent: true},
+		{name: "resolved alert adds event", timelineEvents: true, issueType: issueTypeIncident, status: "resolved", expectEvent: true},
+		{name: "no event if disabled", issueType: issueTypeIncident, status: "firing"},
+		{name: "no event for regular issue", timelineEvents: true, issueType: "issue", status: "firing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGitlab{responses: map[string]string{
+				"GET " + issuesPath:   `[{"id":10,"iid":1,"issue_type":"` + tt.issueType + `"}]`,
+				"PUT " + issuePath:    `{"id":10,"iid":1}`,
+				"POST " + notesPath:   `{"id":1}`,
+				"POST " + graphqlPath: `{"data":{"timelineEventCreate":{"errors":[]}}}`,
+			}}
+			g := newTestGitlab(t, fake)
+			g.incident = config.IncidentConfig{Enabled: true, TimelineEvents: tt.timelineEvents}
+			if err := g.CreateIssue(context.Background(), testWebhook(tt.status, tt.status)); err != nil {
+				t.Fatal(err)
+			}
+			events := 0
+			for _, r := range fake.recorded() {
+				if r == "POST "+graphqlPath {
+					events++
+				}
+			}
+			if !tt.expectEvent {
+				if events != 0 {
+					t.Errorf("expected no timeline event, got %d", events)
+				}
+				return
+			}
+			if events != 1 {
+				t.Fatalf("expected one timeline event, got %d", events)
+			}
+			variables, _ := fake.request(t, http.MethodPost, graphqlPath).body["variables"].(map[string]interface{})
+			expectedNote := g.timelineEventNote(testWebhook(tt.status, tt.status))
+			if variables["incidentId"] != "gid://gitlab/Issue/10" || variables["note"] != expectedNote {
+				t.Errorf("expected event %q of incident 10, got variables %v", expectedNote, variables)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauthHTTPClient returns HTTP client authorizing the requests with tokens obtained using the OAuth client credentials flow.
+// The tokens are refreshed automatically once they expire.
+func oauthHTTPClient(gitlabURL string, cfg *config.OAuthConfig) (*http.Client, error) {
+	secret, err := os.ReadFile(cfg.ClientSecretFile)
+	if err != nil {
+		return nil, err
+	}
+	tokenURL := cfg.TokenURL
+	if tokenURL == "" {
+		u, err := url.Parse(gitlabURL)
+		if err != nil {
+			return nil, err
+		}
+		u.Path = "/oauth/token"
+		tokenURL = u.String()
+	}
+	ccConfig := clientcredentials.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: strings.TrimSpace(string(secret)),
+		TokenURL:     tokenURL,
+		Scopes:       cfg.Scopes,
+	}
+	return ccConfig.Client(context.Background()), nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+var rateLimiterWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "prometheus_gitlab_notifier_gitlab_rate_limiter_wait_seconds",
+	Help:    "Time the Gitlab API requests spent waiting for the client-side rate limiter.",
+	Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+})
+
+func init() {
+	metrics.Register(rateLimiterWait)
+}
+
+// newRateLimiter returns token bucket rate limiter of the Gitlab API requests observing the time spent waiting for it.
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	return &rateLimiter{limiter: rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), cfg.Burst)}
+}
+
+type rateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// Wait blocks until the request is allowed by the limiter.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.limiter.Wait(ctx)
+	rateLimiterWait.Observe(time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	log "github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+)
+
+func (g *Gitlab) listActiveMilestones(ctx context.Context, route *routing.Route, title string) ([]*gitlab.Milestone, error) {
+	logger := tracing.Logger(ctx, g.logger)
+	options := &gitlab.ListMilestonesOptions{
+		ListOptions:             gitlab.ListOptions{PerPage: 100},
+		State:                   gitlab.String("active"),
+		IncludeParentMilestones: gitlab.Bool(true),
+	}
+	if title != "" {
+		options.Title = gitlab.String(title)
+	}
+	milestones, response, err := g.client.Milestones.ListMilestones(route.ProjectID(), options, gitlab.WithContext(ctx))
+	if err != nil {
+		metrics.ReportError("FailedToListGitlabMilestones", "gitlab")
+		logger.WithFields(log.Fields{"err": err, "response": response}).Error("failed to list gitlab milestones")
+		return nil, err
+	}
+	return milestones, nil
+}
+
+// currentMilestone picks the active milestone which is already started and ends the soonest.
+func (g *Gitlab) currentMilestone(milestones []*gitlab.Milestone, now time.Time) *gitlab.Milestone {
+	var current *gitlab.Milestone
+	for _, m := range milestones {
+		if m.StartDate != nil && time.Time(*m.StartDate).After(now) {
+			continue
+		}
+		if m.DueDate != nil && time.Time(*m.DueDate).AddDate(0, 0, 1).Before(now) {
+			continue
+		}
+		if current == nil || current.DueDate == nil || (m.DueDate != nil && time.Time(*m.DueDate).Before(time.Time(*current.DueDate))) {
+			current = m
+		}
+	}
+	return current
+}
+
+func (g *Gitlab) findMilestoneID(ctx context.Context, route *routing.Route, title string, current bool) (int, error) {
+	milestones, err := g.listActiveMilestones(ctx, route, title)
+	if err != nil {
+		return 0, err
+	}
+	if current {
+		if m := g.currentMilestone(milestones, time.Now()); m != nil {
+			return m.ID, nil
+		}
+		return 0, fmt.Errorf("no currently active milestone found")
+	}
+	if len(milestones) == 0 {
+		return 0, fmt.Errorf("active milestone %q not found", title)
+	}
+	return milestones[0].ID, nil
+}
+
+// setSeverityFields sets due date, weight and milestone of the new issue based on the severity of the alert.
+func (g *Gitlab) setSeverityFields(ctx context.Context, route *routing.Route, msg *alertmanager.Webhook, options *gitlab.CreateIssueOptions) {
+	logger := tracing.Logger(ctx, g.logger)
+	severity := msg.CommonLabels[g.severityLabel]
+	cfg, ok := g.severities[severity]
+	if !ok {
+		return
+	}
+	if cfg.DueIn > 0 {
+		dueDate := gitlab.ISOTime(time.Now().Add(time.Duration(cfg.DueIn)))
+		options.DueDate = &dueDate
+	}
+	if cfg.Weight != nil {
+		options.Weight = gitlab.Int(*cfg.Weight)
+	}
+	if cfg.Milestone != "" || cfg.CurrentMilestone {
+		milestoneID, err := g.findMilestoneID(ctx, route, cfg.Milestone, cfg.CurrentMilestone)
+		if err != nil {
+			// Do not fail the issue creation just because of missing milestone.
+			logger.WithFields(log.Fields{"err": err, "severity": severity, "project": route.Project}).Warn("failed to find milestone for the issue, skipping it")
+			return
+		}
+		options.MilestoneID = gitlab.Int(milestoneID)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/prometheus/common/model"
+	"github.com/xanzy/go-gitlab"
+)
+
+func isoDate(t time.Time) *gitlab.ISOTime {
+	d := gitlab.ISOTime(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	return &d
+}
+
+func TestCurrentMilestone(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		name       string
+		milestones []*gitlab.Milestone
+		expected   int
+	}{
+		{name: "no milestones"},
+		{name: "not started yet", milestones: []*gitlab.Milestone{{ID: 1, StartDate: isoDate(now.Add(day))}}},
+		{name: "already due", milestones: []*gitlab.Milestone{{ID: 1, DueDate: isoDate(now.Add(-day))}}},
+		{name: "due today is still current", milestones: []*gitlab.Milestone{{ID: 1, StartDate: isoDate(now.Add(-day)), DueDate: isoDate(now)}}, expected: 1},
+		{name: "without dates is current", milestones: []*gitlab.Milestone{{ID: 1}}, expected: 1},
+		{
+			name: "earliest due wins",
+			milestones: []*gitlab.Milestone{
+				{ID: 1},
+				{ID: 2, DueDate: isoDate(now.Add(14 * day))},
+				{ID: 3, StartDate: isoDate(now.Add(-day)), DueDate: isoDate(now.Add(7 * day))},
+				{ID: 4, DueDate: isoDate(now.Add(-2 * day))},
+			},
+			expected: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Gitlab{}
+			got := 0
+			if m := g.currentMilestone(tt.milestones, now); m != nil {
+				got = m.ID
+			}
+			if got != tt.expected {
+				t.Errorf("expected milestone %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetSeverityFields(t *testing.T) {
+	const milestonesPath = "/api/v4/projects/1/milestones"
+	weight := 5
+	severities := map[string]config.SeverityConfig{
+		"critical": {DueIn: model.Duration(48 * time.Hour), Weight: &weight, Milestone: "Incidents"},
+		"warning":  {CurrentMilestone: true},
+		"info":     {Milestone: "Missing"},
+	}
+	tests := []struct {
+		name        string
+		severity    string
+		milestones  string
+		dueDate     *gitlab.ISOTime
+		weight      *int
+		milestoneID *int
+	}{
+		{name: "unknown severity sets nothing", severity: "debug"},
+		{name: "due date, weight and milestone", severity: "critical", milestones: `[{"id":3,"title":"Incidents"}]`, dueDate: isoDate(time.Now().Add(48 * time.Hour)), weight: &weight, milestoneID: gitlab.Int(3)},
+		{name: "current milestone", severity: "warning", milestones: `[{"id":3,"due_date":"2000-01-01"},{"id":4}]`, milestoneID: gitlab.Int(4)},
+		{name: "missing milestone is skipped", severity: "info", milestones: `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGitlab{responses: map[string]string{"GET " + milestonesPath: tt.milestones}}
+			g := newTestGitlab(t, fake)
+			g.severities = severities
+			msg := testWebhook("firing", "firing")
+			msg.CommonLabels["severity"] = tt.severity
+			options := &gitlab.CreateIssueOptions{}
+			g.setSeverityFields(context.Background(), g.rootRoute, msg, options)
+			if (options.DueDate == nil) != (tt.dueDate == nil) || (tt.dueDate != nil && options.DueDate.String() != tt.dueDate.String()) {
+				t.Errorf("expected due date %v, got %v", tt.dueDate, options.DueDate)
+			}
+			if (options.Weight == nil) != (tt.weight == nil) || (tt.weight != nil && *options.Weight != *tt.weight) {
+				t.Errorf("expected weight %v, got %v", tt.weight, options.Weight)
+			}
+			if (options.MilestoneID == nil) != (tt.milestoneID == nil) || (tt.milestoneID != nil && *options.MilestoneID != *tt.milestoneID) {
+				t.Errorf("expected milestone %v, got %v", tt.milestoneID, options.MilestoneID)
+			}
+			if tt.severity == "critical" {
+				list := fake.request(t, http.MethodGet, milestonesPath)
+				if list.query.Get("title") != "Incidents" || list.query.Get("state") != "active" {
+					t.Errorf("expected active milestone looked up by title, got query %v", list.query)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuetemplate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	amtemplate "github.com/prometheus/alertmanager/template"
+)
+
+// mentionBreaker is zero width space inserted after the `@`, so the text is not a mention of a user or a group.
+const mentionBreaker = "\u200b"
+
+// escapedChars are the characters changing formatting of inline Markdown text.
+const escapedChars = "\\`*_~[]<>#|"
+
+// lineStartChars are the characters which at the start of a line make a quick action, list or heading.
+const lineStartChars = "/-+="
+
+// escapeValue escapes the label or annotation value to be rendered as is in the issue text.
+// The Markdown is escaped by the backslash, as well as the quick actions (e.g. `/close`) at the start of lines,
+// and the `@` is followed by zero width space, so it does not mention anyone.
+func escapeValue(value string) string {
+	var b strings.Builder
+	lineStart := true
+	for _, r := range value {
+		switch {
+		case r == '\n':
+			lineStart = true
+			b.WriteRune(r)
+			continue
+		case lineStart && (r == ' ' || r == '\t'):
+			b.WriteRune(r)
+			continue
+		case lineStart && strings.ContainsRune(lineStartChars, r), strings.ContainsRune(escapedChars, r):
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '@':
+			b.WriteRune(r)
+			b.WriteString(mentionBreaker)
+		default:
+			b.WriteRune(r)
+		}
+		lineStart = false
+	}
+	return b.String()
+}
+
+// escapeFuncName is name of the function escaping the printed values, added to the output actions by the escapeTree.
+const escapeFuncName = "escapeOutput"
+
+// unescapedFuncs are the functions whose output is printed as is, since it is already escaped or it is an URL.
+var unescapedFuncs = map[string]bool{
+	"raw":                true,
+	"markdownEscape":     true,
+	"silenceURL":         true,
+	"prometheusGraphURL": true,
+	"grafanaExploreURL":  true,
+}
+
+// escapeOutput formats the value the same way as the template prints it and escapes it by the escapeValue.
+func escapeOutput(value interface{}) string {
+	if value == nil {
+		return "<no value>"
+	}
+	return escapeValue(fmt.Sprint(value))
+}
+
+// escapeTree adds the escapeOutput function to the end of all the actions printing a value in the node and its children.
+// The actions ending with one of the unescapedFuncs or printing a string constant of the template itself are left as is.
+func escapeTree(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeTree(child)
+		}
+	case *parse.ActionNode:
+		// Assignments of variables print nothing.
+		if len(n.Pipe.Decl) > 0 || !escapesOutput(n.Pipe) {
+			return
+		}
+		// Same as the html/template escaper, the command is not bound to the tree.
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(escapeFuncName).SetTree(nil).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		escapeTree(n.List)
+		escapeTree(n.ElseList)
+	case *parse.RangeNode:
+		escapeTree(n.List)
+		escapeTree(n.ElseList)
+	case *parse.WithNode:
+		escapeTree(n.List)
+		escapeTree(n.ElseList)
+	}
+}
+
+// escapesOutput returns whether output of the pipeline has to be escaped.
+func escapesOutput(pipe *parse.PipeNode) bool {
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	if len(last.Args) == 0 {
+		return true
+	}
+	switch arg := last.Args[0].(type) {
+	case *parse.IdentifierNode:
+		return !unescapedFuncs[arg.Ident]
+	case *parse.StringNode:
+		return len(pipe.Cmds) > 1 || len(last.Args) > 1
+	}
+	return true
+}
+
+// Execute renders the issue text using the template with all the printed values escaped by the escapeValue,
+// so the alerts can't inject Markdown, quick actions or mentions to the issue. The data itself is not modified,
+// so the conditions and functions work with the original values.
+// The `raw` function prints the original value, e.g. `{{ raw .CommonAnnotations.description }}`.
+func Execute(tpl *template.Template, w io.Writer, data *amtemplate.Data) error {
+	if data == nil {
+		return errors.New("no alert data to render")
+	}
+	clone, err := tpl.Clone()
+	if err != nil {
+		return err
+	}
+	clone.Funcs(template.FuncMap{escapeFuncName: escapeOutput})
+	// The clone shares the parse trees with the original template, which is also used to render the title without escaping.
+	for _, t := range clone.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		t.Tree = t.Tree.Copy()
+		escapeTree(t.Tree.Root)
+	}
+	return clone.Execute(w, data)
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuetemplate
+
+import (
+	"strings"
+	"testing"
+
+	amtemplate "github.com/prometheus/alertmanager/template"
+)
+
+func TestEscapeValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "node_exporter", expected: `node\_exporter`},
+		{value: "**bold** `code` [link](http://example.com) <b>", expected: `\*\*bold\*\* \` + "`" + `code\` + "`" + ` \[link\](http://example.com) \<b\>`},
+		{value: `C:\dir`, expected: `C:\\dir`},
+		{value: "/close", expected: `\/close`},
+		{value: "text\n  /close\n- item\n# heading", expected: "text\n  \\/close\n\\- item\n\\# heading"},
+		{value: "a/b - c + d = e", expected: "a/b - c + d = e"},
+		{value: "ping @admin", expected: "ping @\u200badmin"},
+		{value: "", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := escapeValue(tt.value); got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecute(t *testing.T) {
+	data := &amtemplate.Data{
+		CommonLabels:      amtemplate.KV{"job": "node_exporter", "team": "@ops"},
+		CommonAnnotations: amtemplate.KV{"description": "**disk** full", "summary": "/close\n/assign @root ping @user"},
+		ExternalURL:       "http://alertmanager.example.com",
+	}
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "printed value", text: `{{ .CommonLabels.job }}`, expected: `node\_exporter`},
+		{name: "comparison with original value", text: `{{ if eq .CommonLabels.job "node_exporter" }}node{{ end }}`, expected: "node"},
+		{name: "function with original value", text: `{{ .CommonLabels.job | replace "_" " " }}`, expected: "node exporter"},
+		{name: "function output", text: `{{ .CommonLabels.job | upper }}`, expected: `NODE\_EXPORTER`},
+		{name: "variable", text: `{{ $job := .CommonLabels.job }}{{ $job }}`, expected: `node\_exporter`},
+		{name: "range", text: `{{ range $k, $v := .CommonLabels }}{{ raw $k }}={{ $v }};{{ end }}`, expected: "job=node\\_exporter;team=@\u200bops;"},
+		{name: "defined template", text: `{{ define "x" }}{{ .description }}{{ end }}{{ template "x" .CommonAnnotations }}`, expected: `\*\*disk\*\* full`},
+		{name: "raw", text: `{{ raw .CommonAnnotations.description }}`, expected: "**disk** full"},
+		{name: "markdownEscape is not escaped twice", text: `{{ markdownEscape .CommonLabels.job }}`, expected: `node\_exporter`},
+		{name: "markdownEscape of quick action and mention", text: `{{ markdownEscape .CommonAnnotations.summary }}`, expected: "\\/close\n\\/assign @\u200broot ping @\u200buser"},
+		{name: "markdownEscape in pipeline", text: `{{ .CommonAnnotations.summary | markdownEscape }}`, expected: "\\/close\n\\/assign @\u200broot ping @\u200buser"},
+		{name: "silenceURL", text: `{{ silenceURL .ExternalURL .CommonLabels }}`, expected: "http://alertmanager.example.com/#/silences/new?filter=%7Bjob=%22node_exporter%22,team=%22@ops%22%7D"},
+		{name: "string constant", text: "{{ `**` }}", expected: "**"},
+		{name: "missing value", text: `{{ .CommonLabels.missing }}`, expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := Parse("test", tt.text, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			if err := Execute(tpl, &out, data); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, out.String())
+			}
+			// The original template, used to render the title, is not escaped.
+			out.Reset()
+			if err := tpl.Execute(&out, data); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(out.String(), "\\") && !strings.Contains(tt.name, "markdownEscape") {
+				t.Fatalf("expected the original template not to be escaped, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestExecuteWithoutData(t *testing.T) {
+	tpl, err := Default(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Execute(tpl, &strings.Builder{}, nil); err == nil {
+		t.Fatal("expected error when rendering without data")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuetemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+	// The timezone database is embedded, so the formatTime function works even if the system has none, e.g. in the Docker image.
+	_ "time/tzdata"
+
+	amtemplate "github.com/prometheus/alertmanager/template"
+)
+
+// Options configures the alerting functions available in the issue templates.
+type Options struct {
+	// GrafanaURL is base URL of the Grafana used by the grafanaExploreURL function.
+	GrafanaURL string
+	// GrafanaDatasource is UID of the Prometheus datasource used by the grafanaExploreURL function.
+	GrafanaDatasource string
+}
+
+// alertingFuncs returns the alerting specific functions available in the issue templates in addition to the sprig functions.
+func alertingFuncs(opts Options) map[string]interface{} {
+	return map[string]interface{}{
+		"alertDuration":      alertDuration,
+		"humanizeDuration":   humanizeDuration,
+		"formatTime":         formatTime,
+		"prometheusExpr":     prometheusExpr,
+		"prometheusGraphURL": prometheusGraphURL,
+		"grafanaExploreURL": func(expr string) (string, error) {
+			return grafanaExploreURL(opts, expr)
+		},
+		"silenceURL":     silenceURL,
+		"markdownEscape": markdownEscape,
+		// The values are escaped only when rendering the issue text, see Execute.
+		"raw": func(value string) string { return value },
+	}
+}
+
+// alertDuration returns for how long the alert is firing, or was firing if it is resolved.
+func alertDuration(alert amtemplate.Alert) time.Duration {
+	if alert.Status == "resolved" && !alert.EndsAt.IsZero() {
+		return alert.EndsAt.Sub(alert.StartsAt)
+	}
+	return time.Since(alert.StartsAt)
+}
+
+// humanizeDuration formats the duration or number of seconds in format `1d 2h 3m 4s`, the same as the Prometheus humanizeDuration function.
+func humanizeDuration(value interface{}) (string, error) {
+	var seconds float64
+	switch v := value.(type) {
+	case time.Duration:
+		seconds = v.Seconds()
+	case float64:
+		seconds = v
+	case int:
+		seconds = float64(v)
+	case int64:
+		seconds = float64(v)
+	default:
+		return "", fmt.Errorf("humanizeDuration expects duration or number of seconds, got %T", value)
+	}
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return fmt.Sprintf("%.4g", seconds), nil
+	}
+	sign := ""
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	if seconds < 1 {
+		if seconds == 0 {
+			return "0s", nil
+		}
+		return fmt.Sprintf("%s%.4gms", sign, seconds*1000), nil
+	}
+	total := int64(seconds)
+	days := total / 86400
+	hours := total / 3600 % 24
+	minutes := total / 60 % 60
+	secs := seconds - float64(total-total%60)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%s%dd %dh %dm %.4gs", sign, days, hours, minutes, secs), nil
+	case hours > 0:
+		return fmt.Sprintf("%s%dh %dm %.4gs", sign, hours, minutes, secs), nil
+	case minutes > 0:
+		return fmt.Sprintf("%s%dm %.4gs", sign, minutes, secs), nil
+	}
+	return fmt.Sprintf("%s%.4gs", sign, secs), nil
+}
+
+// formatTime formats the time using the Go layout in the timezone given by its IANA name, e.g. `Europe/Prague`.
+func formatTime(layout string, timezone string, t time.Time) (string, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return "", err
+	}
+	return t.In(location).Format(layout), nil
+}
+
+// prometheusExpr returns the PromQL expression of the alerting rule from the generator URL of the alert.
+func prometheusExpr(generatorURL string) (string, error) {
+	u, err := url.Parse(generatorURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Query().Get("g0.expr"), nil
+}
+
+// prometheusGraphURL returns URL of the Prometheus graph of the alerting rule expression from the generator URL of the alert.
+func prometheusGraphURL(generatorURL string) (string, error) {
+	u, err := url.Parse(generatorURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	// The generator URL opens the table view of the expression.
+	query.Set("g0.tab", "0")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// grafanaExploreURL returns URL of the Grafana Explore querying the PromQL expression using the configured Grafana and datasource.
+func grafanaExploreURL(opts Options, expr string) (string, error) {
+	if opts.GrafanaURL == "" {
+		return "", fmt.Errorf("grafanaExploreURL requires the Grafana URL to be configured")
+	}
+	u, err := url.Parse(opts.GrafanaURL)
+	if err != nil {
+		return "", err
+	}
+	left, err := json.Marshal(map[string]interface{}{
+		"datasource": opts.GrafanaDatasource,
+		"queries":    []map[string]string{{"refId": "A", "expr": expr}},
+		"range":      map[string]string{"from": "now-1h", "to": "now"},
+	})
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/explore"
+	u.RawQuery = url.Values{"left": []string{string(left)}}.Encode()
+	return u.String(), nil
+}
+
+// silenceURL returns URL of the Alertmanager silence creation form pre-filled with matchers of the labels.
+func silenceURL(externalURL string, labels amtemplate.KV) (string, error) {
+	u, err := url.Parse(externalURL)
+	if err != nil {
+		return "", err
+	}
+	matchers := make([]string, 0, len(labels))
+	for _, pair := range labels.SortedPairs() {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", pair.Name, pair.Value))
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+	u.RawQuery = ""
+	u.Fragment = "/silences/new?filter={" + strings.Join(matchers, ",") + "}"
+	return u.String(), nil
+}
+
+// markdownEscape escapes the text the same way as the printed values are escaped, see escapeValue,
+// so it can be used in the templates rendered without the escaping, such as the issue title.
+// It is not meant for text in code spans or blocks, where the escapes are rendered literally.
+func markdownEscape(text string) string {
+	return escapeValue(text)
+}
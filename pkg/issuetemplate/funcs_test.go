@@ -0,0 +1,104 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuetemplate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	amtemplate "github.com/prometheus/alertmanager/template"
+)
+
+func TestHumanizeDuration(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{value: 0, expected: "0s"},
+		{value: 0.25, expected: "250ms"},
+		{value: 1, expected: "1s"},
+		{value: int64(61), expected: "1m 1s"},
+		{value: 3661, expected: "1h 1m 1s"},
+		{value: 90061.5, expected: "1d 1h 1m 1.5s"},
+		{value: -61, expected: "-1m 1s"},
+		{value: 90 * time.Second, expected: "1m 30s"},
+		{value: math.NaN(), expected: "NaN"},
+	}
+	for _, tt := range tests {
+		got, err := humanizeDuration(tt.value)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.value, err)
+		}
+		if got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.value, tt.expected, got)
+		}
+	}
+	if _, err := humanizeDuration("1m"); err == nil {
+		t.Error("expected error for string value")
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	got, err := formatTime("2006-01-02 15:04 MST", "Europe/Prague", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2024-01-01 11:00 CET"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if _, err := formatTime(time.RFC3339, "Nowhere/Unknown", at); err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+}
+
+func TestSilenceURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		externalURL string
+		labels      amtemplate.KV
+		expected    string
+	}{
+		{
+			name:        "sorted matchers",
+			externalURL: "http://alertmanager.example.com",
+			labels:      amtemplate.KV{"job": "node", "alertname": "NodeDown"},
+			expected:    "http://alertmanager.example.com/#/silences/new?filter=%7Balertname=%22NodeDown%22,job=%22node%22%7D",
+		},
+		{
+			name:        "path prefix, query and fragment",
+			externalURL: "http://alertmanager.example.com/prefix?x=1#alerts",
+			labels:      amtemplate.KV{"alertname": "NodeDown"},
+			expected:    "http://alertmanager.example.com/prefix/#/silences/new?filter=%7Balertname=%22NodeDown%22%7D",
+		},
+		{
+			name:        "quoted value",
+			externalURL: "http://alertmanager.example.com/",
+			labels:      amtemplate.KV{"summary": `disk "data" full`},
+			expected:    "http://alertmanager.example.com/#/silences/new?filter=%7Bsummary=%22disk%20%5C%22data%5C%22%20full%22%7D",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := silenceURL(tt.externalURL, tt.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
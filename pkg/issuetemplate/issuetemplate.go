@@ -0,0 +1,69 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuetemplate
+
+import (
+	_ "embed"
+	"os"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+)
+
+//go:embed default_issue.tmpl
+var defaultIssueTemplate string
+
+// TitleTemplateName is name of the template which, if defined in the issue template, is used to render the issue title.
+const TitleTemplateName = "title"
+
+// FuncMap returns the functions available in the issue templates, the sprig functions and the alerting functions configured by the opts.
+func FuncMap(opts Options) template.FuncMap {
+	funcs := template.FuncMap(sprig.FuncMap())
+	for name, f := range alertingFuncs(opts) {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// Parse parses the given text as issue template with all the supported functions.
+// Missing keys of the labels and annotations are rendered as empty strings, so alerts without some label do not fail the template.
+func Parse(name string, text string, opts Options) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Funcs(FuncMap(opts)).Parse(text)
+}
+
+// Default returns the parsed default issue template embedded in the binary.
+func Default(opts Options) (*template.Template, error) {
+	return Parse("base", defaultIssueTemplate, opts)
+}
+
+// ParseFile reads and parses the issue template file.
+func ParseFile(path string, opts Options) (*template.Template, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, string(contents), opts)
+}
+
+// TitleTemplate returns the issue title template. If titleText is set it is parsed as the title template,
+// otherwise the `title` template defined in the issue template is used. Returns nil if there is none of those.
+func TitleTemplate(issueTemplate *template.Template, titleText string, opts Options) (*template.Template, error) {
+	if titleText != "" {
+		return Parse(TitleTemplateName, titleText, opts)
+	}
+	if issueTemplate == nil {
+		return nil, nil
+	}
+	return issueTemplate.Lookup(TitleTemplateName), nil
+}
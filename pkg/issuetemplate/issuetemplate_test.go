@@ -0,0 +1,52 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuetemplate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMissingKeys(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: `{{ markdownEscape .CommonLabels.team }}`, expected: ""},
+		{text: `{{ .CommonLabels.team | upper }}`, expected: ""},
+		{text: `team: "{{ .CommonLabels.team }}"`, expected: `team: ""`},
+		{text: `{{ if eq .CommonLabels.team "" }}no team{{ end }}`, expected: "no team"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			tpl, err := Parse("test", tt.text, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Validate(tpl, SampleData(), false); err != nil {
+				t.Fatalf("expected template to pass validation, got %v", err)
+			}
+			if err := Validate(tpl, SampleData(), true); err == nil {
+				t.Fatal("expected missing key to fail the strict validation")
+			}
+			var out strings.Builder
+			if err := Execute(tpl, &out, SampleData()); err != nil {
+				t.Fatalf("expected template passing validation to render, got %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issuetemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	amtemplate "github.com/prometheus/alertmanager/template"
+)
+
+// SampleData returns built-in alert group used to validate the templates.
+// It contains the labels and annotations commonly used by the Prometheus alerting rules.
+func SampleData() *amtemplate.Data {
+	startsAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	alert := func(instance string) amtemplate.Alert {
+		return amtemplate.Alert{
+			Status: "firing",
+			Labels: amtemplate.KV{
+				"alertname": "SampleAlert",
+				"severity":  "warning",
+				"job":       "node",
+				"instance":  instance,
+			},
+			Annotations: amtemplate.KV{
+				"title":       "Sample alert is firing",
+				"summary":     "Sample alert is firing on " + instance,
+				"description": "Sample alert used to validate the issue templates.",
+				"runbook_url": "https://runbooks.example.com/SampleAlert",
+			},
+			StartsAt:     startsAt,
+			EndsAt:       time.Time{},
+			GeneratorURL: "http://prometheus.example.com/graph?g0.expr=up+%3D%3D+0&g0.tab=1",
+			Fingerprint:  "0123456789abcdef",
+		}
+	}
+	return &amtemplate.Data{
+		Receiver: "sample-receiver",
+		Status:   "firing",
+		Alerts:   amtemplate.Alerts{alert("node-1:9100"), alert("node-2:9100")},
+		GroupLabels: amtemplate.KV{
+			"alertname": "SampleAlert",
+		},
+		CommonLabels: amtemplate.KV{
+			"alertname": "SampleAlert",
+			"severity":  "warning",
+			"job":       "node",
+		},
+		CommonAnnotations: amtemplate.KV{
+			"title":       "Sample alert is firing",
+			"description": "Sample alert used to validate the issue templates.",
+			"runbook_url": "https://runbooks.example.com/SampleAlert",
+		},
+		ExternalURL: "http://alertmanager.example.com",
+	}
+}
+
+// LoadFixture reads the Alertmanager webhook JSON file to be used to validate the templates.
+func LoadFixture(path string) (*amtemplate.Data, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var message webhook.Message
+	if err := json.Unmarshal(contents, &message); err != nil {
+		return nil, fmt.Errorf("invalid webhook format of the template fixture %s: %w", path, err)
+	}
+	if message.Data == nil {
+		return nil, fmt.Errorf("template fixture %s contains no alerts", path)
+	}
+	return message.Data, nil
+}
+
+// Validate executes the template with the data and returns error if it fails.
+// If missingKeyError is set, unlike rendering of the issues, accessing a missing key of the data is an error, so typos in the label names are caught.
+// Otherwise the missing keys are empty strings the same as when rendering the issues, so only the errors not caused by the data missing keys are returned.
+func Validate(tpl *template.Template, data *amtemplate.Data, missingKeyError bool) error {
+	clone, err := tpl.Clone()
+	if err != nil {
+		return err
+	}
+	if missingKeyError {
+		clone.Option("missingkey=error")
+	}
+	return clone.Execute(io.Discard, data)
+}
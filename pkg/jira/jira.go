@@ -0,0 +1,197 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jira
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+)
+
+const (
+	pageLimit = 50
+	// Jira limits length of the issue summary in characters.
+	maxSummaryLength = 255
+	// Format of the time fields returned by the Jira API.
+	timeFormat = "2006-01-02T15:04:05.000-0700"
+)
+
+// New returns new Jira issues backend of the tracker.Simple.
+func New(cfg config.JiraConfig, token string) *Jira {
+	return &Jira{
+		client: tracker.NewHTTPClient(config.TrackerJira, strings.TrimSuffix(cfg.URL, "/")+"/rest/api/2", func(r *http.Request) {
+			if cfg.Username != "" {
+				r.SetBasicAuth(cfg.Username, token)
+			} else {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}),
+		issueType:       cfg.IssueType,
+		closeTransition: cfg.CloseTransition,
+	}
+}
+
+// Jira creates issues in Jira projects, the project is the Jira project key.
+type Jira struct {
+	client          *tracker.HTTPClient
+	issueType       string
+	closeTransition string
+}
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Description string   `json:"description"`
+		Labels      []string `json:"labels"`
+		Created     string   `json:"created"`
+	} `json:"fields"`
+}
+
+func (i *jiraIssue) toIssue() (*tracker.Issue, error) {
+	created, err := time.Parse(timeFormat, i.Fields.Created)
+	if err != nil {
+		return nil, fmt.Errorf("invalid created time of issue %s: %w", i.Key, err)
+	}
+	return &tracker.Issue{ID: i.Key, Description: i.Fields.Description, Labels: i.Fields.Labels, CreatedAt: created}, nil
+}
+
+// sanitizeLabels replaces whitespaces in the labels, since Jira labels can't contain them.
+func sanitizeLabels(labels []string) []string {
+	res := make([]string, 0, len(labels))
+	for _, l := range labels {
+		res = append(res, strings.Join(strings.Fields(l), "_"))
+	}
+	return res
+}
+
+func quoteJQL(s string) string {
+	return strconv.Quote(s)
+}
+
+// Name of the issue tracking system.
+func (j *Jira) Name() string {
+	return config.TrackerJira
+}
+
+// ListOpenIssues returns unresolved issues having all the labels, created after the given time if set, newest first.
+func (j *Jira) ListOpenIssues(ctx context.Context, project string, labels []string, createdAfter *time.Time) ([]*tracker.Issue, error) {
+	conditions := []string{"project = " + quoteJQL(project), "statusCategory != Done"}
+	for _, l := range sanitizeLabels(labels) {
+		conditions = append(conditions, "labels = "+quoteJQL(l))
+	}
+	if createdAfter != nil {
+		// Absolute times in JQL are interpreted in the time zone of the user, so relative time in minutes is used
+		// with one minute reserve and the issues are filtered precisely below.
+		minutes := int(math.Ceil(time.Since(*createdAfter).Minutes())) + 1
+		conditions = append(conditions, fmt.Sprintf(`created >= "-%dm"`, minutes))
+	}
+	query := url.Values{
+		"jql":        {strings.Join(conditions, " AND ") + " ORDER BY created DESC"},
+		"fields":     {"description,labels,created"},
+		"maxResults": {strconv.Itoa(pageLimit)},
+	}
+	var res []*tracker.Issue
+	for startAt := 0; ; startAt += pageLimit {
+		query.Set("startAt", strconv.Itoa(startAt))
+		var page struct {
+			Issues []jiraIssue `json:"issues"`
+			Total  int         `json:"total"`
+		}
+		if _, err := j.client.Do(ctx, http.MethodGet, "/search?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, i := range page.Issues {
+			issue, err := i.toIssue()
+			if err != nil {
+				return nil, err
+			}
+			if createdAfter != nil && issue.CreatedAt.Before(*createdAfter) {
+				return res, nil
+			}
+			res = append(res, issue)
+		}
+		if len(page.Issues) < pageLimit || startAt+len(page.Issues) >= page.Total {
+			return res, nil
+		}
+	}
+}
+
+// CreateIssue creates new issue and returns its key.
+func (j *Jira) CreateIssue(ctx context.Context, project string, title string, description string, labels []string) (string, error) {
+	// Truncate by characters, so multi-byte characters are not cut in half.
+	if runes := []rune(title); len(runes) > maxSummaryLength {
+		title = string(runes[:maxSummaryLength])
+	}
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": project},
+			"issuetype":   map[string]string{"name": j.issueType},
+			"summary":     title,
+			"description": description,
+			"labels":      sanitizeLabels(labels),
+		},
+	}
+	var created jiraIssue
+	if _, err := j.client.Do(ctx, http.MethodPost, "/issue", body, &created); err != nil {
+		return "", err
+	}
+	return created.Key, nil
+}
+
+// UpdateIssue sets the description and labels of the issue.
+func (j *Jira) UpdateIssue(ctx context.Context, _ string, issue *tracker.Issue) error {
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"description": issue.Description,
+			"labels":      sanitizeLabels(issue.Labels),
+		},
+	}
+	_, err := j.client.Do(ctx, http.MethodPut, "/issue/"+issue.ID, body, nil)
+	return err
+}
+
+// AddComment adds comment to the issue.
+func (j *Jira) AddComment(ctx context.Context, _ string, issue *tracker.Issue, body string) error {
+	_, err := j.client.Do(ctx, http.MethodPost, "/issue/"+issue.ID+"/comment", map[string]string{"body": body}, nil)
+	return err
+}
+
+// CloseIssue transitions the issue using the configured close transition.
+func (j *Jira) CloseIssue(ctx context.Context, _ string, issue *tracker.Issue) error {
+	var transitions struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	if _, err := j.client.Do(ctx, http.MethodGet, "/issue/"+issue.ID+"/transitions", nil, &transitions); err != nil {
+		return err
+	}
+	for _, t := range transitions.Transitions {
+		if strings.EqualFold(t.Name, j.closeTransition) {
+			body := map[string]interface{}{"transition": map[string]string{"id": t.ID}}
+			_, err := j.client.Do(ctx, http.MethodPost, "/issue/"+issue.ID+"/transitions", body, nil)
+			return err
+		}
+	}
+	return fmt.Errorf("transition %s is not available for issue %s", j.closeTransition, issue.ID)
+}
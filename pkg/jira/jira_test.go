@@ -0,0 +1,196 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+)
+
+type apiRequest struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   map[string]interface{}
+}
+
+// fakeAPI records the requests and responds with the response configured for "METHOD path", 404 otherwise.
+type fakeAPI struct {
+	mtx       sync.Mutex
+	requests  []apiRequest
+	responses map[string]string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := apiRequest{method: r.Method, path: r.URL.Path, query: r.URL.Query(), header: r.Header}
+	_ = json.NewDecoder(r.Body).Decode(&req.body)
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.requests = append(f.requests, req)
+	response, ok := f.responses[r.Method+" "+r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(response))
+}
+
+func (f *fakeAPI) recorded() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var res []string
+	for _, r := range f.requests {
+		res = append(res, r.method+" "+r.path)
+	}
+	return res
+}
+
+func newTestJira(t *testing.T, username string, responses map[string]string) (*Jira, *fakeAPI) {
+	t.Helper()
+	fake := &fakeAPI{responses: responses}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return New(config.JiraConfig{URL: srv.URL, Username: username, IssueType: "Task", CloseTransition: "Done"}, "token"), fake
+}
+
+func TestCreateIssue(t *testing.T) {
+	tests := []struct {
+		name            string
+		username        string
+		title           string
+		expectedSummary string
+		expectedAuth    string
+	}{
+		{name: "bearer token", title: "Firing alert", expectedSummary: "Firing alert", expectedAuth: "Bearer token"},
+		{name: "basic authentication", username: "user", title: "Firing alert", expectedSummary: "Firing alert", expectedAuth: "Basic dXNlcjp0b2tlbg=="},
+		{name: "long summary is truncated", title: strings.Repeat("a", 300), expectedSummary: strings.Repeat("a", maxSummaryLength), expectedAuth: "Bearer token"},
+		{name: "long summary is truncated by characters", title: strings.Repeat("ř", 300), expectedSummary: strings.Repeat("ř", maxSummaryLength), expectedAuth: "Bearer token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, fake := newTestJira(t, tt.username, map[string]string{"POST /rest/api/2/issue": `{"key":"OPS-7"}`})
+			id, err := j.CreateIssue(context.Background(), "OPS", tt.title, "description", []string{"alert", "alertname::Foo Bar"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != "OPS-7" {
+				t.Errorf("expected issue key OPS-7, got %s", id)
+			}
+			req := fake.requests[0]
+			if got := req.header.Get("Authorization"); got != tt.expectedAuth {
+				t.Errorf("expected authorization %q, got %q", tt.expectedAuth, got)
+			}
+			fields, _ := req.body["fields"].(map[string]interface{})
+			summary, _ := fields["summary"].(string)
+			if summary != tt.expectedSummary || !utf8.ValidString(summary) {
+				t.Errorf("expected summary %q, got %q", tt.expectedSummary, summary)
+			}
+			expected := map[string]interface{}{
+				"project":     map[string]interface{}{"key": "OPS"},
+				"issuetype":   map[string]interface{}{"name": "Task"},
+				"summary":     summary,
+				"description": "description",
+				"labels":      []interface{}{"alert", "alertname::Foo_Bar"},
+			}
+			if !reflect.DeepEqual(fields, expected) {
+				t.Errorf("expected issue fields %v, got %v", expected, fields)
+			}
+		})
+	}
+}
+
+func TestUpdateExistingIssue(t *testing.T) {
+	now := time.Now()
+	search, _ := json.Marshal(map[string]interface{}{
+		"total": 2,
+		"issues": []map[string]interface{}{
+			{"key": "OPS-8", "fields": map[string]interface{}{"description": "newest", "labels": []string{"alert"}, "created": now.Format(timeFormat)}},
+			{"key": "OPS-7", "fields": map[string]interface{}{"description": "too old", "created": now.Add(-2 * time.Hour).Format(timeFormat)}},
+		},
+	})
+	j, fake := newTestJira(t, "", map[string]string{
+		"GET /rest/api/2/search":      string(search),
+		"PUT /rest/api/2/issue/OPS-8": ``,
+	})
+	since := now.Add(-time.Hour)
+	found, err := j.ListOpenIssues(context.Background(), "OPS", []string{"alert", "alertname::Foo Bar"}, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != "OPS-8" || found[0].Description != "newest" || !reflect.DeepEqual(found[0].Labels, []string{"alert"}) {
+		t.Fatalf("expected only the issue OPS-8 created within the hour, got %+v", found)
+	}
+	jql := fake.requests[0].query.Get("jql")
+	for _, condition := range []string{`project = "OPS"`, "statusCategory != Done", `labels = "alert"`, `labels = "alertname::Foo_Bar"`, `created >= "-62m"`, "ORDER BY created DESC"} {
+		if !strings.Contains(jql, condition) {
+			t.Errorf("expected %s in the JQL %q", condition, jql)
+		}
+	}
+	issue := &tracker.Issue{ID: "OPS-8", Description: "appended", Labels: []string{"alert", "appended-alerts::1"}}
+	if err := j.UpdateIssue(context.Background(), "OPS", issue); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"fields": map[string]interface{}{"description": "appended", "labels": []interface{}{"alert", "appended-alerts::1"}}}
+	if got := fake.requests[1].body; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected issue updated with %v, got %v", expected, got)
+	}
+}
+
+func TestResolveIssue(t *testing.T) {
+	j, fake := newTestJira(t, "", map[string]string{
+		"POST /rest/api/2/issue/OPS-8/comment":     `{"id":"1"}`,
+		"GET /rest/api/2/issue/OPS-8/transitions":  `{"transitions":[{"id":"11","name":"In Progress"},{"id":"31","name":"done"}]}`,
+		"POST /rest/api/2/issue/OPS-8/transitions": ``,
+		"GET /rest/api/2/issue/OPS-9/transitions":  `{"transitions":[{"id":"11","name":"In Progress"}]}`,
+	})
+	issue := &tracker.Issue{ID: "OPS-8"}
+	if err := j.AddComment(context.Background(), "OPS", issue, "resolved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.CloseIssue(context.Background(), "OPS", issue); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.requests[0].body["body"]; got != "resolved" {
+		t.Errorf("expected resolution comment, got %v", got)
+	}
+	expected := map[string]interface{}{"transition": map[string]interface{}{"id": "31"}}
+	if got := fake.requests[2].body; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected issue closed by the Done transition, got %v", got)
+	}
+	if err := j.CloseIssue(context.Background(), "OPS", &tracker.Issue{ID: "OPS-9"}); err == nil {
+		t.Error("expected error closing issue without the close transition")
+	}
+	expectedRequests := []string{
+		"POST /rest/api/2/issue/OPS-8/comment",
+		"GET /rest/api/2/issue/OPS-8/transitions",
+		"POST /rest/api/2/issue/OPS-8/transitions",
+		"GET /rest/api/2/issue/OPS-9/transitions",
+	}
+	if got := fake.recorded(); !reflect.DeepEqual(got, expectedRequests) {
+		t.Errorf("expected requests %v, got %v", expectedRequests, got)
+	}
+}
@@ -14,6 +14,7 @@
 package prober
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"sync"
@@ -32,11 +33,39 @@ func NewInRouter(logger log.FieldLogger, router *mux.Router) *Prober {
 	return p
 }
 
+// Check returns error if the checked component is not ready.
+type Check func() error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// CheckResult is result of single readiness check.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessResult is the readiness response body with results of all the checks.
+type ReadinessResult struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+const (
+	statusOK     = "ok"
+	statusFailed = "failed"
+)
+
 // Prober holds application readiness/liveness status and provides handlers for reporting it.
 type Prober struct {
 	logger         log.FieldLogger
 	serverReadyMtx sync.RWMutex
 	serverReady    error
+	checksMtx      sync.RWMutex
+	checks         []namedCheck
 }
 
 func (p *Prober) registerInRouter(router *mux.Router) {
@@ -49,18 +78,39 @@ func (p *Prober) livenessHandler(w http.ResponseWriter, _ *http.Request) {
 	_, _ = io.WriteString(w, `OK`)
 }
 
-func (p *Prober) writeFailedReadiness(w http.ResponseWriter, err error) {
-	p.logger.WithField("err", err).Error("readiness probe failed")
-	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+func (p *Prober) readinessHandler(w http.ResponseWriter, _ *http.Request) {
+	result := p.Readiness()
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(result)
 }
 
-func (p *Prober) readinessHandler(w http.ResponseWriter, _ *http.Request) {
-	if err := p.isReady(); err != nil {
-		p.writeFailedReadiness(w, err)
-		return
+// RegisterCheck adds the check to be evaluated by the readiness probe.
+func (p *Prober) RegisterCheck(name string, check Check) {
+	p.checksMtx.Lock()
+	defer p.checksMtx.Unlock()
+	p.checks = append(p.checks, namedCheck{name: name, check: check})
+}
+
+// Readiness evaluates all the readiness checks, the server is ready only if all of them succeed.
+func (p *Prober) Readiness() ReadinessResult {
+	p.checksMtx.RLock()
+	checks := append([]namedCheck{{name: "server", check: p.isReady}}, p.checks...)
+	p.checksMtx.RUnlock()
+	result := ReadinessResult{Status: statusOK}
+	for _, c := range checks {
+		checkResult := CheckResult{Name: c.name, Status: statusOK}
+		if err := c.check(); err != nil {
+			p.logger.WithFields(log.Fields{"check": c.name, "err": err}).Error("readiness probe failed")
+			checkResult.Status = statusFailed
+			checkResult.Error = err.Error()
+			result.Status = statusFailed
+		}
+		result.Checks = append(result.Checks, checkResult)
 	}
-	w.WriteHeader(http.StatusOK)
-	_, _ = io.WriteString(w, `OK`)
+	return result
 }
 
 // SetServerNotReady sets the readiness probe to invalid state.
@@ -0,0 +1,51 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processor
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+)
+
+// backoff returns exponential backoff for the given retry capped by the max backoff.
+// The backoff is randomized between half and full of the computed duration, so retries of many alerts failing at once are spread.
+func backoff(retry int, cfg config.RetryConfig) time.Duration {
+	d := time.Duration(cfg.Backoff)
+	maxBackoff := time.Duration(cfg.MaxBackoff)
+	for i := 0; i < retry && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryDelay returns how long to wait before retrying the alert which failed with the error and false if it should not be retried at all.
+// The delay requested by the API is capped by the max backoff, so the alert is not held back for too long.
+func retryDelay(err error, retry int, cfg config.RetryConfig) (time.Duration, bool) {
+	if tracker.IsPermanentError(err) {
+		return 0, false
+	}
+	if d, ok := tracker.RetryAfter(err); ok {
+		if maxBackoff := time.Duration(cfg.MaxBackoff); d > maxBackoff {
+			d = maxBackoff
+		}
+		return d, true
+	}
+	return backoff(retry, cfg), true
+}
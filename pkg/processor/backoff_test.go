@@ -0,0 +1,114 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
+	"github.com/prometheus/common/model"
+)
+
+var testRetryConfig = config.RetryConfig{
+	Limit:      5,
+	Backoff:    model.Duration(time.Minute),
+	MaxBackoff: model.Duration(10 * time.Minute),
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 0, max: time.Minute},
+		{retry: 1, max: 2 * time.Minute},
+		{retry: 2, max: 4 * time.Minute},
+		{retry: 3, max: 8 * time.Minute},
+		{retry: 4, max: 10 * time.Minute},
+		{retry: 100, max: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.retry), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				d := backoff(tt.retry, testRetryConfig)
+				if d < tt.max/2 || d > tt.max {
+					t.Fatalf("expected backoff between %s and %s, got %s", tt.max/2, tt.max, d)
+				}
+			}
+		})
+	}
+}
+
+func httpError(statusCode int, header http.Header) error {
+	return fmt.Errorf("request failed: %w", &tracker.HTTPError{Method: http.MethodPost, URL: "http://example.com", StatusCode: statusCode, Header: header})
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+		// delay is the expected delay, if zero the randomized backoff is expected.
+		delay time.Duration
+	}{
+		{name: "network error", err: errors.New("connection refused"), retry: true},
+		{name: "server error", err: httpError(http.StatusInternalServerError, nil), retry: true},
+		{name: "unauthorized", err: httpError(http.StatusUnauthorized, nil), retry: true},
+		{name: "forbidden", err: httpError(http.StatusForbidden, nil), retry: false},
+		{name: "not found", err: httpError(http.StatusNotFound, nil), retry: false},
+		{name: "conflict", err: httpError(http.StatusConflict, nil), retry: true},
+		{name: "rate limited without header", err: httpError(http.StatusTooManyRequests, nil), retry: true},
+		{
+			name:  "retry after seconds",
+			err:   httpError(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"30"}}),
+			retry: true,
+			delay: 30 * time.Second,
+		},
+		{
+			name:  "retry after capped by max backoff",
+			err:   httpError(http.StatusServiceUnavailable, http.Header{"Retry-After": []string{"86400"}}),
+			retry: true,
+			delay: 10 * time.Minute,
+		},
+		{
+			name:  "rate limit reset capped by max backoff",
+			err:   httpError(http.StatusTooManyRequests, http.Header{"Ratelimit-Reset": []string{strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10)}}),
+			retry: true,
+			delay: 10 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, retry := retryDelay(tt.err, 0, testRetryConfig)
+			if retry != tt.retry {
+				t.Fatalf("expected retry %t, got %t", tt.retry, retry)
+			}
+			if !retry {
+				return
+			}
+			if tt.delay != 0 && d != tt.delay {
+				t.Fatalf("expected delay %s, got %s", tt.delay, d)
+			}
+			if tt.delay == 0 && (d < time.Duration(testRetryConfig.Backoff)/2 || d > time.Duration(testRetryConfig.Backoff)) {
+				t.Fatalf("expected backoff delay, got %s", d)
+			}
+		})
+	}
+}
@@ -15,12 +15,23 @@ package processor
 
 import (
 	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
 	"time"
 
 	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
-	"github.com/fusakla/prometheus-gitlab-notifier/pkg/gitlab"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/deadletter"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/queue"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracker"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -32,52 +43,231 @@ var (
 		Name: "prometheus_gitlab_notifier_processed_alerts_retried_total",
 		Help: "Count of retries.",
 	})
+	droppedItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prometheus_gitlab_notifier_dropped_alerts_total",
+		Help: "Count of alerts dropped without being processed by the reason.",
+	}, []string{"reason"})
+	processingLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "prometheus_gitlab_notifier_alert_processing_latency_seconds",
+		Help:    "Time from receiving the alert webhook to successfully processing it in the issue tracker, including the retries.",
+		Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600, 14400},
+	})
 )
 
 func init() {
-	prometheus.MustRegister(processedItems)
-	prometheus.MustRegister(retryCount)
+	metrics.Register(processedItems)
+	metrics.Register(retryCount)
+	metrics.Register(droppedItems)
+	metrics.Register(processingLatency)
 }
 
 // New returns new Processor which handles the alert queue and retrying.
-func New(logger log.FieldLogger) *Processor {
+// If the deadLetters store is set, the dropped alerts are stored to it, so they can be replayed later.
+func New(logger log.FieldLogger, deadLetters *deadletter.Store) *Processor {
 	return &Processor{
-		logger: logger,
+		logger:      logger,
+		deadLetters: deadLetters,
 	}
 }
 
 type Processor struct {
-	logger log.FieldLogger
+	logger      log.FieldLogger
+	deadLetters *deadletter.Store
+	running     bool
+	runningMtx  sync.RWMutex
+	workers     sync.WaitGroup
+	configMtx   sync.RWMutex
+	tracker     tracker.IssueTracker
+	retryConfig config.RetryConfig
+}
+
+// ApplyConfig sets the issue tracker and retry configuration to be used for processing of the following alerts.
+// Can be called while processing to reload the configuration.
+func (p *Processor) ApplyConfig(issueTracker tracker.IssueTracker, retryConfig config.RetryConfig) {
+	p.configMtx.Lock()
+	defer p.configMtx.Unlock()
+	p.tracker = issueTracker
+	p.retryConfig = retryConfig
+}
+
+func (p *Processor) config() (tracker.IssueTracker, config.RetryConfig) {
+	p.configMtx.RLock()
+	defer p.configMtx.RUnlock()
+	return p.tracker, p.retryConfig
+}
+
+// CheckIssueTracker checks the current issue tracker is healthy if it supports the health checking.
+func (p *Processor) CheckIssueTracker() error {
+	issueTracker, _ := p.config()
+	if checker, ok := issueTracker.(tracker.HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	return nil
+}
+
+// CheckRunning returns error if the processor is not processing the alerts from the queue.
+func (p *Processor) CheckRunning() error {
+	p.runningMtx.RLock()
+	defer p.runningMtx.RUnlock()
+	if !p.running {
+		return errors.New("processor is not running")
+	}
+	return nil
 }
 
-// Process processes alerts from the given channel and creates Gitlab issues from them.
-func (p *Processor) Process(ctx context.Context, gitlab *gitlab.Gitlab, alertChannel chan *alertmanager.Webhook, retryLimit int, retryBackoff time.Duration) {
-	doneChannel := make(chan bool, 1)
+func (p *Processor) setRunning(running bool) {
+	p.runningMtx.Lock()
+	defer p.runningMtx.Unlock()
+	p.running = running
+}
+
+// drop removes the alert from the queue and stores it to the dead-letter store if configured.
+func (p *Processor) drop(logger log.FieldLogger, alertQueue *queue.Queue, alert *alertmanager.Webhook, reason string, lastErr error) {
+	alertQueue.Done(alert)
+	droppedItems.WithLabelValues(reason).Inc()
+	if p.deadLetters == nil {
+		return
+	}
+	if err := p.deadLetters.Add(alert, reason, lastErr); err != nil {
+		metrics.ReportError("FailedToStoreDeadLetter", "")
+		logger.WithFields(log.Fields{"group_key": alert.GroupKey, "err": err}).Error("failed to store dropped alert to the dead-letter store")
+	}
+}
+
+// process creates issue from the alert, failed alerts are pushed back to the queue to be retried or dropped.
+// Returns true if the alert is going to be retried.
+// The time the alert spent in the queue and its processing are traced as part of the trace started when the alert was received.
+func (p *Processor) process(ctx context.Context, alertQueue *queue.Queue, alert *alertmanager.Webhook) bool {
+	ctx = tracing.Extract(ctx, alert.TraceContext)
+	attributes := trace.WithAttributes(attribute.String("alert_grouping_key", alert.GroupKey), attribute.Int("alert_retry_count", alert.RetryCount()))
+	_, queueSpan := tracing.Start(ctx, "queue", attributes, trace.WithTimestamp(alert.QueuedAt))
+	queueSpan.End()
+	ctx, span := tracing.Start(ctx, "process alert", attributes)
+	defer span.End()
+	logger := tracing.Logger(ctx, p.logger)
+
+	logger.WithField("group_key", alert.GroupKey).Debug("fetched alert from queue for processing")
+	issueTracker, retryConfig := p.config()
+	if err := issueTracker.CreateIssue(ctx, alert); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if alert.RetryCount() >= retryConfig.Limit-1 {
+			logger.WithFields(log.Fields{"group_key": alert.GroupKey, "retry_count": retryConfig.Limit}).Warn("alert exceeded maximum number of retries, dropping it")
+			span.SetAttributes(attribute.String("alert_drop_reason", deadletter.ReasonRetriesExhausted))
+			p.drop(logger, alertQueue, alert, deadletter.ReasonRetriesExhausted, err)
+			return false
+		}
+		retryBackoff, ok := retryDelay(err, alert.RetryCount(), retryConfig)
+		if !ok {
+			logger.WithFields(log.Fields{"group_key": alert.GroupKey, "err": err}).Warn("alert failed with error which won't succeed if retried, dropping it")
+			span.SetAttributes(attribute.String("alert_drop_reason", deadletter.ReasonPermanentError))
+			p.drop(logger, alertQueue, alert, deadletter.ReasonPermanentError, err)
+			return false
+		}
+		alert.Retry()
+		alert.QueuedAt = time.Now().Add(retryBackoff)
+		if pushErr := alertQueue.PushAfter(alert, retryBackoff); pushErr != nil {
+			logger.WithFields(log.Fields{"group_key": alert.GroupKey, "err": pushErr}).Error("failed to add alert to queue for retrying, dropping it")
+			span.SetAttributes(attribute.String("alert_drop_reason", deadletter.ReasonQueueError))
+			p.drop(logger, alertQueue, alert, deadletter.ReasonQueueError, err)
+			return false
+		}
+		retryCount.Inc()
+		processedItems.Inc()
+		span.SetAttributes(attribute.String("alert_retry_backoff", retryBackoff.String()))
+		logger.WithFields(log.Fields{"group_key": alert.GroupKey, "retry_backoff": retryBackoff}).Warn("alert will be added to queue for retrying")
+		return true
+	}
+	alertQueue.Done(alert)
+	processingLatency.Observe(time.Since(alert.ReceivedAt).Seconds())
+	processedItems.Inc()
+	return false
+}
+
+// groupRetry is the alert of a group waiting to be retried and the later alerts of the group held back until it is processed.
+type groupRetry struct {
+	retried *alertmanager.Webhook
+	held    []*alertmanager.Webhook
+}
+
+// processInOrder processes the alert unless there is an older alert of the same group waiting to be retried,
+// in which case the alert is held back and processed once the retried one succeeds or is dropped,
+// so for example the resolved alert is never processed before the retried firing one.
+// The retries map holds the state of the groups processed by the worker, so it is not shared between the workers.
+func (p *Processor) processInOrder(ctx context.Context, alertQueue *queue.Queue, retries map[string]*groupRetry, alert *alertmanager.Webhook) {
+	pending := []*alertmanager.Webhook{alert}
+	if r, ok := retries[alert.GroupKey]; ok {
+		if r.retried != alert {
+			p.logger.WithField("group_key", alert.GroupKey).Debug("holding back alert until the older alert of the same group is retried")
+			r.held = append(r.held, alert)
+			return
+		}
+		pending = append(pending, r.held...)
+		delete(retries, alert.GroupKey)
+	}
+	for i, a := range pending {
+		if p.process(ctx, alertQueue, a) {
+			retries[a.GroupKey] = &groupRetry{retried: a, held: pending[i+1:]}
+			return
+		}
+	}
+}
+
+// Wait blocks until all the workers finished processing of their alerts after the processing stopped.
+func (p *Processor) Wait() {
+	p.workers.Wait()
+}
+
+// shard returns index of the worker processing alerts of the group.
+func shard(groupKey string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(groupKey))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// Process processes alerts from the given queue and creates issues from them. ApplyConfig has to be called before.
+// The alerts are distributed to the given number of workers by their group key, so different groups are processed in parallel,
+// but alerts of the same group are processed one by one in the order they were received, including the retried ones.
+// The processing stops once the context is canceled or the queue is closed, see Wait.
+func (p *Processor) Process(ctx context.Context, alertQueue *queue.Queue, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	workerChannels := make([]chan *alertmanager.Webhook, workers)
+	for i := range workerChannels {
+		workerChannel := make(chan *alertmanager.Webhook)
+		workerChannels[i] = workerChannel
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			retries := map[string]*groupRetry{}
+			for alert := range workerChannel {
+				// The alert being processed is not canceled with the context, so it is finished before exiting.
+				p.processInOrder(context.Background(), alertQueue, retries, alert)
+			}
+		}()
+	}
+	p.setRunning(true)
 	go func() {
-		defer close(doneChannel)
+		defer func() {
+			p.setRunning(false)
+			for _, workerChannel := range workerChannels {
+				close(workerChannel)
+			}
+		}()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case alert, ok := <-alertChannel:
+			case alert, ok := <-alertQueue.Chan():
 				if !ok {
 					return
 				}
-				p.logger.WithField("group_key", alert.GroupKey).Debug("fetched alert from queue for processing")
-				if err := gitlab.CreateIssue(alert); err != nil {
-					if alert.RetryCount() >= retryLimit-1 {
-						p.logger.WithFields(log.Fields{"group_key": alert.GroupKey, "retry_count": retryLimit}).Warn("alert exceeded maximum number of retries, dropping it")
-						continue
-					}
-					go func() {
-						time.Sleep(retryBackoff)
-						alert.Retry()
-						alertChannel <- alert
-						retryCount.Inc()
-						p.logger.WithFields(log.Fields{"group_key": alert.GroupKey, "retry_backoff": retryBackoff}).Warn("added alert to queue for retrying ")
-					}()
+				select {
+				case workerChannels[shard(alert.GroupKey, workers)] <- alert:
+				case <-ctx.Done():
+					return
 				}
-				processedItems.Inc()
 			}
 		}
 	}()
@@ -0,0 +1,82 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/queue"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// failingTracker fails the first issue creation with retryable error and records statuses of all the created issues.
+type failingTracker struct {
+	mtx      sync.Mutex
+	failed   bool
+	statuses []string
+}
+
+func (f *failingTracker) CreateIssue(_ context.Context, msg *alertmanager.Webhook) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.statuses = append(f.statuses, msg.Status)
+	if !f.failed {
+		f.failed = true
+		return httpError(http.StatusServiceUnavailable, nil)
+	}
+	return nil
+}
+
+func (f *failingTracker) recorded() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]string{}, f.statuses...)
+}
+
+func TestRetriedAlertIsProcessedBeforeLaterAlertsOfGroup(t *testing.T) {
+	logger := log.New()
+	logger.Out = io.Discard
+	issueTracker := &failingTracker{}
+	p := New(logger, nil)
+	p.ApplyConfig(issueTracker, config.RetryConfig{Limit: 5, Backoff: model.Duration(10 * time.Millisecond), MaxBackoff: model.Duration(10 * time.Millisecond)})
+	q := queue.NewInMemory(logger, 10)
+	p.Process(context.Background(), q, 2)
+
+	for _, status := range []string{"firing", "resolved"} {
+		if err := q.Push(alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{Data: &template.Data{Status: status}, GroupKey: "a"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{"firing", "firing", "resolved"}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(issueTracker.recorded()) < len(expected) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	q.Close()
+	p.Wait()
+	if got := issueTracker.recorded(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected issues created in order %v, got %v", expected, got)
+	}
+}
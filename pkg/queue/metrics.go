@@ -0,0 +1,52 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	lengthDesc = prometheus.NewDesc(
+		"prometheus_gitlab_notifier_queue_length",
+		"Number of alerts waiting in the queue to be processed.",
+		nil, nil,
+	)
+	capacityDesc = prometheus.NewDesc(
+		"prometheus_gitlab_notifier_queue_capacity",
+		"Maximum number of alerts the queue can hold.",
+		nil, nil,
+	)
+)
+
+// NewCollector returns Prometheus collector exposing the current length and capacity of the queue.
+func NewCollector(q *Queue) prometheus.Collector {
+	return &collector{queue: q}
+}
+
+type collector struct {
+	queue *Queue
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lengthDesc
+	ch <- capacityDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(lengthDesc, prometheus.GaugeValue, float64(c.queue.Len()))
+	ch <- prometheus.MustNewConstMetric(capacityDesc, prometheus.GaugeValue, float64(c.queue.Cap()))
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrClosed is returned when pushing to already closed queue.
+var ErrClosed = errors.New("queue is closed")
+
+// NewInMemory returns new Queue holding the webhooks only in memory.
+func NewInMemory(logger log.FieldLogger, size int) *Queue {
+	return &Queue{
+		logger: logger,
+		ch:     make(chan *alertmanager.Webhook, size),
+		done:   make(chan struct{}),
+	}
+}
+
+// NewDurable returns new Queue persisting the webhooks to the given directory, so they survive restart of the application.
+// All the webhooks found in the directory which were not processed yet are replayed to the queue including their retry count.
+func NewDurable(logger log.FieldLogger, size int, dir string) (*Queue, error) {
+	store, err := newDiskStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		logger: logger,
+		ch:     make(chan *alertmanager.Webhook, size),
+		done:   make(chan struct{}),
+		store:  store,
+	}
+	entries, err := store.load(logger)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		logger.WithFields(log.Fields{"dir": dir, "count": len(entries)}).Info("replaying unprocessed alerts from the durable queue")
+	}
+	// Replay in background since there could be more webhooks than the queue can hold until they are consumed.
+	// The webhooks waiting for retry are delayed each on its own, so they do not hold back the rest,
+	// but the later webhooks of the same group are replayed after them, so the group stays in order.
+	go func() {
+		var delayed []storedWebhook
+		heldBack := map[string][]*alertmanager.Webhook{}
+		for _, e := range entries {
+			groupKey := e.webhook.GroupKey
+			if held, ok := heldBack[groupKey]; ok {
+				heldBack[groupKey] = append(held, e.webhook)
+				continue
+			}
+			if time.Until(e.notBefore) > 0 {
+				delayed = append(delayed, e)
+				heldBack[groupKey] = []*alertmanager.Webhook{}
+				continue
+			}
+			q.enqueueAfter(e.webhook, 0)
+		}
+		for _, e := range delayed {
+			go q.enqueueGroupAfter(append([]*alertmanager.Webhook{e.webhook}, heldBack[e.webhook.GroupKey]...), time.Until(e.notBefore))
+		}
+	}()
+	return q, nil
+}
+
+// Queue of the webhooks waiting to be processed.
+// If it is durable, each webhook is persisted until marked as done.
+type Queue struct {
+	logger log.FieldLogger
+	ch     chan *alertmanager.Webhook
+	// done is closed once the queue is closed to unblock the pending pushes.
+	done      chan struct{}
+	store     *diskStore
+	closed    bool
+	closedMtx sync.RWMutex
+	// senders tracks the pending pushes, so the ch is not closed while they could still send to it.
+	senders sync.WaitGroup
+}
+
+// Push adds the webhook to the end of the queue, blocks if the queue is full.
+func (q *Queue) Push(w *alertmanager.Webhook) error {
+	if q.store != nil {
+		if err := q.store.save(w, time.Time{}); err != nil {
+			q.logger.WithFields(log.Fields{"err": err, "group_key": w.GroupKey}).Error("failed to persist alert to the durable queue")
+			return err
+		}
+	}
+	return q.enqueue(w)
+}
+
+// PushAfter adds the webhook to the end of the queue after the given delay. Used for retrying of the failed webhooks.
+// The durable queue persists the webhook immediately, so the webhook is replayed even if the application restarts during the delay.
+func (q *Queue) PushAfter(w *alertmanager.Webhook, delay time.Duration) error {
+	if q.store != nil {
+		if err := q.store.save(w, time.Now().Add(delay)); err != nil {
+			q.logger.WithFields(log.Fields{"err": err, "group_key": w.GroupKey}).Error("failed to persist alert to the durable queue")
+			return err
+		}
+	}
+	go q.enqueueAfter(w, delay)
+	return nil
+}
+
+func (q *Queue) enqueueAfter(w *alertmanager.Webhook, delay time.Duration) {
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-q.done:
+			timer.Stop()
+		}
+	}
+	if err := q.enqueue(w); err != nil {
+		if q.store != nil {
+			q.logger.WithField("group_key", w.GroupKey).Info("queue is closed, alert stays persisted and will be replayed on next start")
+			return
+		}
+		q.logger.WithField("group_key", w.GroupKey).Warn("queue is closed, dropping alert")
+	}
+}
+
+// enqueueGroupAfter adds the webhooks of the group in the given order once the first of them is due after the delay.
+func (q *Queue) enqueueGroupAfter(ws []*alertmanager.Webhook, delay time.Duration) {
+	q.enqueueAfter(ws[0], delay)
+	for _, w := range ws[1:] {
+		q.enqueueAfter(w, 0)
+	}
+}
+
+func (q *Queue) enqueue(w *alertmanager.Webhook) error {
+	q.closedMtx.RLock()
+	if q.closed {
+		q.closedMtx.RUnlock()
+		return ErrClosed
+	}
+	q.senders.Add(1)
+	q.closedMtx.RUnlock()
+	defer q.senders.Done()
+	// The lock is not held while blocked on full queue, so the queue can be closed meanwhile.
+	select {
+	case q.ch <- w:
+		return nil
+	case <-q.done:
+		return ErrClosed
+	}
+}
+
+// Chan returns channel to consume the queued webhooks from. It is closed once the queue is closed.
+func (q *Queue) Chan() <-chan *alertmanager.Webhook {
+	return q.ch
+}
+
+// Done marks the webhook as processed, so the durable queue won't replay it anymore.
+func (q *Queue) Done(w *alertmanager.Webhook) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.remove(w); err != nil {
+		q.logger.WithFields(log.Fields{"err": err, "group_key": w.GroupKey}).Error("failed to remove processed alert from the durable queue")
+	}
+}
+
+// Len returns number of webhooks waiting in the queue.
+func (q *Queue) Len() int {
+	return len(q.ch)
+}
+
+// Cap returns maximum number of webhooks the queue can hold.
+func (q *Queue) Cap() int {
+	return cap(q.ch)
+}
+
+// Close stops accepting new webhooks, fails the pending pushes with ErrClosed and closes the channel returned by Chan.
+func (q *Queue) Close() {
+	q.closedMtx.Lock()
+	if q.closed {
+		q.closedMtx.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.done)
+	q.closedMtx.Unlock()
+	q.senders.Wait()
+	close(q.ch)
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	log "github.com/sirupsen/logrus"
+)
+
+func testLogger() log.FieldLogger {
+	logger := log.New()
+	logger.Out = io.Discard
+	return logger
+}
+
+func testWebhook(groupKey string) *alertmanager.Webhook {
+	return alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{Data: &template.Data{}, GroupKey: groupKey})
+}
+
+func TestCloseDoesNotWaitForBlockedPush(t *testing.T) {
+	q := NewInMemory(testLogger(), 1)
+	if err := q.Push(testWebhook("a")); err != nil {
+		t.Fatal(err)
+	}
+	pushErr := make(chan error)
+	go func() { pushErr <- q.Push(testWebhook("b")) }()
+	// Let the push block on the full queue.
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		q.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked by the pending push")
+	}
+	if err := <-pushErr; !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from the pending push, got %v", err)
+	}
+	if err := q.Push(testWebhook("c")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after close, got %v", err)
+	}
+	var got []string
+	for w := range q.Chan() {
+		got = append(got, w.GroupKey)
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Fatalf("expected only the alert pushed before close, got %v", got)
+	}
+}
+
+func TestDiskStoreLoadOrder(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried := testWebhook("b")
+	retried.Retry()
+	retried.Retry()
+	notBefore := time.Now().Add(time.Hour).Truncate(time.Second)
+	for _, s := range []struct {
+		w         *alertmanager.Webhook
+		notBefore time.Time
+	}{
+		{testWebhook("a"), time.Time{}},
+		{retried, notBefore},
+		{testWebhook("c"), time.Time{}},
+	} {
+		if err := store.save(s.w, s.notBefore); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corrupted := filepath.Join(dir, "00000000000000000000-0000000000.json")
+	if err := os.WriteFile(corrupted, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := newDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := loaded.load(testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, groupKey := range []string{"a", "b", "c"} {
+		if entries[i].webhook.GroupKey != groupKey {
+			t.Errorf("entry %d: expected group key %s, got %s", i, groupKey, entries[i].webhook.GroupKey)
+		}
+	}
+	if entries[1].webhook.RetryCount() != 2 {
+		t.Errorf("expected retry count 2, got %d", entries[1].webhook.RetryCount())
+	}
+	if !entries[1].notBefore.Equal(notBefore) {
+		t.Errorf("expected not before %s, got %s", notBefore, entries[1].notBefore)
+	}
+	if _, err := os.Stat(corrupted + corruptedFileSuffix); err != nil {
+		t.Errorf("expected the corrupted file to be renamed: %v", err)
+	}
+
+	if err := loaded.remove(entries[0].webhook); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = loaded.load(testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].webhook.GroupKey != "b" {
+		t.Fatalf("expected the removed entry not to be loaded again, got %d entries", len(entries))
+	}
+}
+
+func TestDurableReplayDoesNotWaitForDelayedAlerts(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.save(testWebhook("delayed"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.save(testWebhook("due"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewDurable(testLogger(), 10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	select {
+	case w := <-q.Chan():
+		if w.GroupKey != "due" {
+			t.Fatalf("expected the due alert first, got %s", w.GroupKey)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("due alert was held back by the delayed one")
+	}
+}
+
+func TestDurableReplayKeepsGroupOrder(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried := testWebhook("a")
+	retried.Status = "firing"
+	retried.Retry()
+	if err := store.save(retried, time.Now().Add(200*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	newer := testWebhook("a")
+	newer.Status = "resolved"
+	if err := store.save(newer, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.save(testWebhook("b"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewDurable(testLogger(), 10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	expected := []struct {
+		groupKey string
+		status   string
+	}{
+		{groupKey: "b"},
+		{groupKey: "a", status: "firing"},
+		{groupKey: "a", status: "resolved"},
+	}
+	for _, e := range expected {
+		select {
+		case w := <-q.Chan():
+			if w.GroupKey != e.groupKey || w.Status != e.status {
+				t.Fatalf("expected alert of group %q with status %q, got group %q with status %q", e.groupKey, e.status, w.GroupKey, w.Status)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("alert of group %q with status %q was not replayed", e.groupKey, e.status)
+		}
+	}
+}
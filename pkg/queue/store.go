@@ -0,0 +1,162 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	recordFileSuffix    = ".json"
+	corruptedFileSuffix = ".corrupted"
+)
+
+// record is the persisted form of a queued webhook.
+type record struct {
+	Message      webhook.Message   `json:"message"`
+	ReceivedAt   time.Time         `json:"received_at,omitempty"`
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	RetryCount   int               `json:"retry_count"`
+	NotBefore    time.Time         `json:"not_before,omitempty"`
+}
+
+type storedWebhook struct {
+	webhook   *alertmanager.Webhook
+	notBefore time.Time
+}
+
+// diskStore persists each webhook as a separate file in the directory, named so the files sort in the order of arrival.
+type diskStore struct {
+	dir    string
+	mtx    sync.Mutex
+	seq    uint64
+	fileOf map[*alertmanager.Webhook]string
+}
+
+func newDiskStore(dir string) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &diskStore{
+		dir:    dir,
+		fileOf: map[*alertmanager.Webhook]string{},
+	}, nil
+}
+
+func (s *diskStore) fileName(w *alertmanager.Webhook) string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	name, ok := s.fileOf[w]
+	if !ok {
+		s.seq++
+		name = fmt.Sprintf("%020d-%010d%s", time.Now().UnixNano(), s.seq, recordFileSuffix)
+		s.fileOf[w] = name
+	}
+	return name
+}
+
+// save writes the webhook atomically, so the file is either the old or the new version even if the application crashes.
+func (s *diskStore) save(w *alertmanager.Webhook, notBefore time.Time) error {
+	data, err := json.Marshal(record{Message: w.Message, ReceivedAt: w.ReceivedAt, TraceContext: w.TraceContext, RetryCount: w.RetryCount(), NotBefore: notBefore})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, s.fileName(w))
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *diskStore) remove(w *alertmanager.Webhook) error {
+	s.mtx.Lock()
+	name, ok := s.fileOf[w]
+	delete(s.fileOf, w)
+	s.mtx.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// load reads all the persisted webhooks in the order they were received. Files which can't be decoded are renamed, so they are not loaded again.
+func (s *diskStore) load(logger log.FieldLogger) ([]storedWebhook, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range dirEntries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), recordFileSuffix) || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	var res []storedWebhook
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil || r.Message.Data == nil {
+			logger.WithFields(log.Fields{"err": err, "file": path}).Error("failed to decode alert from the durable queue, skipping it")
+			if err := os.Rename(path, path+corruptedFileSuffix); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if r.ReceivedAt.IsZero() {
+			// Persisted by older version not storing the time of receiving.
+			r.ReceivedAt = time.Now()
+		}
+		w := alertmanager.NewWebhookWithRetryCount(r.Message, r.ReceivedAt, r.RetryCount)
+		w.TraceContext = r.TraceContext
+		if r.NotBefore.After(w.QueuedAt) {
+			w.QueuedAt = r.NotBefore
+		}
+		s.fileOf[w] = name
+		res = append(res, storedWebhook{webhook: w, notBefore: r.NotBefore})
+	}
+	return res, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reloader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	lastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "prometheus_gitlab_notifier_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful.",
+	})
+	lastReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "prometheus_gitlab_notifier_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload.",
+	})
+)
+
+func init() {
+	metrics.Register(lastReloadSuccessful)
+	metrics.Register(lastReloadSuccessTimestamp)
+}
+
+// NewInRouter returns new Reloader which registers its endpoint in the Router to allow triggering the reload over HTTP.
+func NewInRouter(logger log.FieldLogger, router *mux.Router, reloadFunc func() error) *Reloader {
+	r := &Reloader{
+		logger:     logger,
+		reloadFunc: reloadFunc,
+	}
+	lastReloadSuccessful.Set(1)
+	lastReloadSuccessTimestamp.SetToCurrentTime()
+	r.registerInRouter(router)
+	return r
+}
+
+// Reloader serializes reloads of the configuration triggered by signal or over HTTP.
+type Reloader struct {
+	logger     log.FieldLogger
+	reloadFunc func() error
+	reloadMtx  sync.Mutex
+}
+
+func (r *Reloader) registerInRouter(router *mux.Router) {
+	router.HandleFunc("/-/reload", r.reloadHandler).Methods(http.MethodPost, http.MethodPut)
+}
+
+func (r *Reloader) reloadHandler(w http.ResponseWriter, _ *http.Request) {
+	if err := r.Reload(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, `OK`)
+}
+
+// Reload reloads the configuration. If it fails, the old configuration stays in use.
+func (r *Reloader) Reload() error {
+	r.reloadMtx.Lock()
+	defer r.reloadMtx.Unlock()
+	start := time.Now()
+	r.logger.Info("reloading configuration")
+	if err := r.reloadFunc(); err != nil {
+		metrics.ReportError("ConfigReloadError", "")
+		lastReloadSuccessful.Set(0)
+		r.logger.WithField("err", err).Error("failed to reload configuration, keeping the old one")
+		return err
+	}
+	lastReloadSuccessful.Set(1)
+	lastReloadSuccessTimestamp.SetToCurrentTime()
+	r.logger.WithField("duration", time.Since(start)).Info("configuration reloaded")
+	return nil
+}
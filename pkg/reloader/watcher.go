@@ -0,0 +1,107 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NewFileWatcher returns new FileWatcher checking the watched files in the given interval
+// and calling the onChange function once content of any of them changes.
+func NewFileWatcher(logger log.FieldLogger, interval time.Duration, onChange func()) *FileWatcher {
+	return &FileWatcher{
+		logger:   logger,
+		interval: interval,
+		onChange: onChange,
+		hashes:   map[string][sha256.Size]byte{},
+	}
+}
+
+// FileWatcher periodically checks content of the files, so it detects also files replaced by renaming or symlink swap
+// as done for example by Kubernetes for mounted secrets.
+type FileWatcher struct {
+	logger   log.FieldLogger
+	interval time.Duration
+	onChange func()
+	hashes   map[string][sha256.Size]byte
+	mtx      sync.Mutex
+}
+
+func fileHash(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// SetFiles replaces the watched files, their current content is considered unchanged.
+func (w *FileWatcher) SetFiles(files ...string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.hashes = map[string][sha256.Size]byte{}
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		// Unreadable file is watched with zero hash, so it is detected once it appears.
+		w.hashes[f], _ = fileHash(f)
+	}
+}
+
+// changed returns the files which content changed since the last check and updates their hashes,
+// so a change which failed to be applied does not trigger the onChange again until the file changes again.
+func (w *FileWatcher) changed() []string {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	var changed []string
+	for f, oldHash := range w.hashes {
+		newHash, err := fileHash(f)
+		if err != nil {
+			w.logger.WithFields(log.Fields{"err": err, "file": f}).Debug("failed to read watched file")
+			continue
+		}
+		if newHash != oldHash {
+			w.hashes[f] = newHash
+			changed = append(changed, f)
+		}
+	}
+	return changed
+}
+
+// Run checks the watched files until the context is canceled.
+func (w *FileWatcher) Run(ctx context.Context) {
+	if w.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed := w.changed(); len(changed) > 0 {
+				w.logger.WithField("files", changed).Info("watched files changed")
+				w.onChange()
+			}
+		}
+	}
+}
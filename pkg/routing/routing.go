@@ -0,0 +1,194 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/issuetemplate"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	amtemplate "github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// Matchers is list of alert label matchers in the Alertmanager syntax, e.g. `team="foo"` or `severity=~"warning|critical"`.
+type Matchers labels.Matchers
+
+// UnmarshalYAML parses the matchers from list of strings in the Alertmanager syntax.
+func (m *Matchers) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var lines []string
+	if err := unmarshal(&lines); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		parsed, err := labels.ParseMatchers(line)
+		if err != nil {
+			return fmt.Errorf("invalid matcher %q: %w", line, err)
+		}
+		*m = append(*m, parsed...)
+	}
+	return nil
+}
+
+// MarshalYAML returns the matchers as list of strings in the Alertmanager syntax.
+func (m Matchers) MarshalYAML() (interface{}, error) {
+	lines := make([]string, len(m))
+	for i, matcher := range m {
+		lines[i] = matcher.String()
+	}
+	return lines, nil
+}
+
+// Route defines to which project and how to create issues for the alerts matching it.
+// The route tree is evaluated similarly to the Alertmanager route tree, the first matching child route wins
+// and all the settings not set in the route are inherited from its parent.
+type Route struct {
+	// Receiver is name of the Alertmanager receiver which has to send the alert to match the route.
+	Receiver string `yaml:"receiver,omitempty"`
+	// Matchers the common labels of the alert group has to match to match the route.
+	Matchers Matchers `yaml:"matchers,omitempty"`
+
+	// Project is numeric ID or path (`group/project`) of the project where to create the issues.
+	Project                string         `yaml:"project,omitempty"`
+	IssueLabels            []string       `yaml:"issue_labels,omitempty"`
+	DynamicIssueLabels     []string       `yaml:"dynamic_issue_labels,omitempty"`
+	IssueTemplateFile      string         `yaml:"issue_template,omitempty"`
+	IssueTitleTemplateText string         `yaml:"issue_title_template,omitempty"`
+	GroupInterval          model.Duration `yaml:"group_interval,omitempty"`
+
+	Routes []*Route `yaml:"routes,omitempty"`
+
+	// IssueTemplate is the parsed issue template, loaded from the IssueTemplateFile.
+	IssueTemplate *template.Template `yaml:"-"`
+	// IssueTitleTemplate is the parsed issue title template, see issuetemplate.TitleTemplate.
+	IssueTitleTemplate *template.Template `yaml:"-"`
+}
+
+// LoadTemplates parses templates of the route and all of its child routes with the functions configured by the opts.
+// Relative template paths are resolved against the baseDir.
+func (r *Route) LoadTemplates(baseDir string, opts issuetemplate.Options) error {
+	if r.IssueTemplateFile != "" {
+		templatePath := r.IssueTemplateFile
+		if !filepath.IsAbs(templatePath) {
+			templatePath = filepath.Join(baseDir, templatePath)
+		}
+		tpl, err := issuetemplate.ParseFile(templatePath, opts)
+		if err != nil {
+			return fmt.Errorf("invalid issue template %s: %w", r.IssueTemplateFile, err)
+		}
+		r.IssueTemplate = tpl
+	}
+	if r.IssueTemplate != nil || r.IssueTitleTemplateText != "" {
+		titleTpl, err := issuetemplate.TitleTemplate(r.IssueTemplate, r.IssueTitleTemplateText, opts)
+		if err != nil {
+			return fmt.Errorf("invalid issue title template %q: %w", r.IssueTitleTemplateText, err)
+		}
+		r.IssueTitleTemplate = titleTpl
+	}
+	for _, child := range r.Routes {
+		if err := child.LoadTemplates(baseDir, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateTemplates executes templates of the route and all of its child routes with the data, see issuetemplate.Validate.
+func (r *Route) ValidateTemplates(data *amtemplate.Data, missingKeyError bool) error {
+	if r.IssueTemplate != nil {
+		if err := issuetemplate.Validate(r.IssueTemplate, data, missingKeyError); err != nil {
+			return fmt.Errorf("invalid issue template %s: %w", r.IssueTemplate.Name(), err)
+		}
+	}
+	if r.IssueTitleTemplate != nil {
+		if err := issuetemplate.Validate(r.IssueTitleTemplate, data, missingKeyError); err != nil {
+			return fmt.Errorf("invalid issue title template %s: %w", r.IssueTitleTemplate.Name(), err)
+		}
+	}
+	for _, child := range r.Routes {
+		if err := child.ValidateTemplates(data, missingKeyError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that the route can be used as a root route.
+// The project is required only if the issues are created in the issue tracker, not if they are only rendered.
+func (r *Route) Validate(projectRequired bool) error {
+	if projectRequired && r.Project == "" {
+		return fmt.Errorf("the root route has to have the project set")
+	}
+	if r.IssueTemplate == nil {
+		return fmt.Errorf("the root route has to have the issue template set")
+	}
+	return nil
+}
+
+// ProjectID returns the project as a numeric ID if possible, otherwise as a project path.
+func (r *Route) ProjectID() interface{} {
+	if id, err := strconv.Atoi(r.Project); err == nil {
+		return id
+	}
+	return r.Project
+}
+
+func (r *Route) matches(msg *alertmanager.Webhook) bool {
+	if r.Receiver != "" && r.Receiver != msg.Receiver {
+		return false
+	}
+	lset := make(model.LabelSet, len(msg.CommonLabels))
+	for k, v := range msg.CommonLabels {
+		lset[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return labels.Matchers(r.Matchers).Matches(lset)
+}
+
+// inherit returns copy of the route with all the unset settings taken from the parent.
+func (r *Route) inherit(parent *Route) *Route {
+	res := *r
+	if res.Project == "" {
+		res.Project = parent.Project
+	}
+	if res.IssueLabels == nil {
+		res.IssueLabels = parent.IssueLabels
+	}
+	if res.DynamicIssueLabels == nil {
+		res.DynamicIssueLabels = parent.DynamicIssueLabels
+	}
+	if res.IssueTemplate == nil {
+		res.IssueTemplate = parent.IssueTemplate
+	}
+	if res.IssueTitleTemplate == nil {
+		res.IssueTitleTemplate = parent.IssueTitleTemplate
+	}
+	if res.GroupInterval == 0 {
+		res.GroupInterval = parent.GroupInterval
+	}
+	return &res
+}
+
+// Match returns the deepest route matching the webhook with all the settings inherited from its parents.
+func (r *Route) Match(msg *alertmanager.Webhook) *Route {
+	for _, child := range r.Routes {
+		if child.matches(msg) {
+			return child.inherit(r).Match(msg)
+		}
+	}
+	return r
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	amtemplate "github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+const testRoutes = `
+project: "1"
+issue_labels: [alert]
+group_interval: 1h
+routes:
+  - receiver: database
+    project: db/issues
+    routes:
+      - matchers: ['severity="critical"']
+        issue_labels: [critical]
+  - matchers: ['team=~"web|api"', 'env!="dev"']
+    project: "2"
+    dynamic_issue_labels: [team]
+    group_interval: 10m
+  - matchers: ['team="web"']
+    project: "3"
+`
+
+func testMessage(receiver string, commonLabels map[string]string) *alertmanager.Webhook {
+	return alertmanager.NewWebhookFromAlertmanagerMessage(webhook.Message{Data: &amtemplate.Data{Receiver: receiver, CommonLabels: commonLabels}})
+}
+
+func TestMatch(t *testing.T) {
+	root := &Route{}
+	if err := yaml.UnmarshalStrict([]byte(testRoutes), root); err != nil {
+		t.Fatal(err)
+	}
+	root.IssueTemplate = template.New("root")
+	tests := []struct {
+		name               string
+		receiver           string
+		labels             map[string]string
+		project            string
+		issueLabels        []string
+		dynamicIssueLabels []string
+		groupInterval      time.Duration
+	}{
+		{name: "no route matches", receiver: "default", labels: map[string]string{"team": "ops"}, project: "1", issueLabels: []string{"alert"}, groupInterval: time.Hour},
+		{name: "receiver matches", receiver: "database", labels: map[string]string{"severity": "warning"}, project: "db/issues", issueLabels: []string{"alert"}, groupInterval: time.Hour},
+		{name: "nested route inherits from all parents", receiver: "database", labels: map[string]string{"severity": "critical"}, project: "db/issues", issueLabels: []string{"critical"}, groupInterval: time.Hour},
+		{name: "all matchers match", receiver: "default", labels: map[string]string{"team": "api", "env": "prod"}, project: "2", issueLabels: []string{"alert"}, dynamicIssueLabels: []string{"team"}, groupInterval: 10 * time.Minute},
+		{name: "first matching route wins", receiver: "default", labels: map[string]string{"team": "web"}, project: "2", issueLabels: []string{"alert"}, dynamicIssueLabels: []string{"team"}, groupInterval: 10 * time.Minute},
+		{name: "following route matches if previous does not", receiver: "default", labels: map[string]string{"team": "web", "env": "dev"}, project: "3", issueLabels: []string{"alert"}, groupInterval: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := root.Match(testMessage(tt.receiver, tt.labels))
+			if route.Project != tt.project {
+				t.Errorf("expected project %s, got %s", tt.project, route.Project)
+			}
+			if !reflect.DeepEqual(route.IssueLabels, tt.issueLabels) {
+				t.Errorf("expected issue labels %v, got %v", tt.issueLabels, route.IssueLabels)
+			}
+			if !reflect.DeepEqual(route.DynamicIssueLabels, tt.dynamicIssueLabels) {
+				t.Errorf("expected dynamic issue labels %v, got %v", tt.dynamicIssueLabels, route.DynamicIssueLabels)
+			}
+			if route.GroupInterval != model.Duration(tt.groupInterval) {
+				t.Errorf("expected group interval %s, got %s", tt.groupInterval, route.GroupInterval)
+			}
+			if route.IssueTemplate != root.IssueTemplate {
+				t.Errorf("expected issue template inherited from the root route")
+			}
+		})
+	}
+}
+
+func TestMatchDoesNotModifyRoutes(t *testing.T) {
+	child := &Route{Receiver: "database"}
+	root := &Route{Project: "1", Routes: []*Route{child}}
+	if route := root.Match(testMessage("database", nil)); route.Project != "1" {
+		t.Fatalf("expected project inherited from the root route, got %q", route.Project)
+	}
+	if child.Project != "" {
+		t.Fatalf("expected the child route to be left unchanged, got project %q", child.Project)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// APIResponse returns status code and headers of the failed issue tracker API response which caused the error.
+func APIResponse(err error) (int, http.Header, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode, httpErr.Header, true
+	}
+	var gitlabErr *gitlab.ErrorResponse
+	if errors.As(err, &gitlabErr) && gitlabErr.Response != nil {
+		return gitlabErr.Response.StatusCode, gitlabErr.Response.Header, true
+	}
+	return 0, nil, false
+}
+
+// IsPermanentError returns true if the error was caused by a client error response of the API which won't succeed if retried.
+// The 401 is not permanent, since the credentials may be expired or rotated and are reloaded meanwhile.
+func IsPermanentError(err error) bool {
+	statusCode, _, ok := APIResponse(err)
+	if !ok || statusCode < 400 || statusCode >= 500 {
+		return false
+	}
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+// RetryAfter returns how long to wait before retrying if the API asked for it in a rate limiting (429) or unavailability (503) response
+// using the `Retry-After` header or the `RateLimit-Reset` header with Unix timestamp of the rate limit reset.
+func RetryAfter(err error) (time.Duration, bool) {
+	statusCode, header, ok := APIResponse(err)
+	if !ok || (statusCode != http.StatusTooManyRequests && statusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return nonNegative(time.Until(t)), true
+		}
+	}
+	// GitHub uses the X- prefixed variant of the header.
+	for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		if v := header.Get(name); v != "" {
+			if reset, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return nonNegative(time.Until(time.Unix(reset, 0))), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPError is returned by the HTTPClient if the API responds with unsuccessful status code.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// NewHTTPClient returns new HTTPClient for JSON API of the named tracker at the baseURL authorizing requests using the setAuth function.
+func NewHTTPClient(tracker string, baseURL string, setAuth func(r *http.Request)) *HTTPClient {
+	return &HTTPClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		setAuth: setAuth,
+		client:  &http.Client{Timeout: 30 * time.Second, Transport: InstrumentRoundTripper(tracker, nil)},
+	}
+}
+
+// HTTPClient is a minimal client of JSON HTTP APIs of the issue tracking systems.
+type HTTPClient struct {
+	baseURL string
+	setAuth func(r *http.Request)
+	client  *http.Client
+}
+
+// BaseURL returns the base URL of the API.
+func (c *HTTPClient) BaseURL() string {
+	return c.baseURL
+}
+
+// Do sends the request with the body encoded as JSON to the path relative to the base URL and decodes the response to out if set.
+func (c *HTTPClient) Do(ctx context.Context, method string, path string, body interface{}, out interface{}) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.setAuth != nil {
+		c.setAuth(req)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp, &HTTPError{Method: method, URL: req.URL.String(), StatusCode: resp.StatusCode, Header: resp.Header, Body: string(respBody)}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
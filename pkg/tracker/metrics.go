@@ -0,0 +1,131 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Actions done with the issues reported by ReportIssueAction.
+const (
+	IssueActionCreated  = "created"
+	IssueActionUpdated  = "updated"
+	IssueActionResolved = "resolved"
+	IssueActionClosed   = "closed"
+)
+
+var (
+	issuesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prometheus_gitlab_notifier_issues_total",
+		Help: "Count of the issues created, updated with appended alerts, resolved and closed in the issue tracker.",
+	}, []string{"tracker", "action"})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prometheus_gitlab_notifier_api_request_duration_seconds",
+		Help:    "Duration of the issue tracker API requests by operation and response status code.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"tracker", "operation", "status_code"})
+
+	// Number of path segments following these ones which are IDs or names.
+	// They are replaced to keep the cardinality of the operation label low.
+	idPathSegments = map[string]int{
+		"projects":    1,
+		"groups":      1,
+		"issues":      1,
+		"notes":       1,
+		"discussions": 1,
+		"milestones":  1,
+		"labels":      1,
+		"users":       1,
+		"issue":       1,
+		"comments":    1,
+		"repos":       2,
+	}
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+)
+
+func init() {
+	metrics.Register(issuesTotal)
+	metrics.Register(apiRequestDuration)
+}
+
+// ReportIssueAction increments count of the issues the given action was done with in the tracker.
+func ReportIssueAction(tracker string, action string) {
+	issuesTotal.WithLabelValues(tracker, action).Inc()
+}
+
+// InstrumentRoundTripper returns http.RoundTripper observing duration of the requests sent by the next one to the tracker API
+// and tracing them.
+// If the next is nil, the http.DefaultTransport is used.
+func InstrumentRoundTripper(tracker string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedRoundTripper{tracker: tracker, next: next}
+}
+
+type instrumentedRoundTripper struct {
+	tracker string
+	next    http.RoundTripper
+}
+
+// RoundTrip sends the request and observes its duration, the request is traced as a span of the trace in the request context.
+func (t *instrumentedRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	operation := r.Method + " " + normalizePath(r.URL.EscapedPath())
+	_, span := tracing.Start(r.Context(), operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("tracker", t.tracker),
+		attribute.String("http.method", r.Method),
+		attribute.String("http.url", r.URL.Redacted()),
+	))
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	apiRequestDuration.WithLabelValues(t.tracker, operation, status).Observe(time.Since(start).Seconds())
+	tracing.EndSpan(span, err)
+	return resp, err
+}
+
+// normalizePath replaces IDs and names in the API request path with `:id` placeholder.
+// Numeric segment following the `api` segment is the API version (e.g. `/rest/api/2`), so it is kept.
+func normalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 0; i < len(segments); i++ {
+		if numericSegment.MatchString(segments[i]) && (i == 0 || segments[i-1] != "api") {
+			segments[i] = ":id"
+			continue
+		}
+		for n := idPathSegments[segments[i]]; n > 0 && i+1 < len(segments) && segments[i+1] != ""; n-- {
+			i++
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
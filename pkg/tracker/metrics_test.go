@@ -0,0 +1,40 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/api/v4/user", expected: "/api/v4/user"},
+		{path: "/api/v4/projects/123/issues", expected: "/api/v4/projects/:id/issues"},
+		{path: "/api/v4/projects/group%2Fproject/issues/5/notes", expected: "/api/v4/projects/:id/issues/:id/notes"},
+		{path: "/api/v4/projects/1/issues/2/discussions/abc/notes", expected: "/api/v4/projects/:id/issues/:id/discussions/:id/notes"},
+		{path: "/api/v4/projects/1/labels/needs%20triage", expected: "/api/v4/projects/:id/labels/:id"},
+		{path: "/api/v4/projects/", expected: "/api/v4/projects/"},
+		{path: "/repos/owner/repo/issues/3/comments", expected: "/repos/:id/:id/issues/:id/comments"},
+		{path: "/rest/api/2/issue/PROJ-1/transitions", expected: "/rest/api/2/issue/:id/transitions"},
+		{path: "/api/v4/version/42", expected: "/api/v4/version/:id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := normalizePath(tt.path); got != tt.expected {
+				t.Fatalf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/config"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/tracing"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Issue is an issue in the issue tracking system as seen by the Simple tracker.
+type Issue struct {
+	// ID identifies the issue in the project, e.g. issue number or issue key.
+	ID          string
+	Description string
+	Labels      []string
+	CreatedAt   time.Time
+}
+
+// Backend is the set of operations an issue tracking system has to support to be used by the Simple tracker.
+// The project is the project of the matched route, its format depends on the issue tracking system.
+type Backend interface {
+	// Name of the issue tracking system used in logs and metrics.
+	Name() string
+	// ListOpenIssues returns open issues having all the labels, created after the given time if set, newest first.
+	ListOpenIssues(ctx context.Context, project string, labels []string, createdAfter *time.Time) ([]*Issue, error)
+	// CreateIssue creates new issue and returns its ID.
+	CreateIssue(ctx context.Context, project string, title string, description string, labels []string) (string, error)
+	// UpdateIssue sets the description and labels of the issue.
+	UpdateIssue(ctx context.Context, project string, issue *Issue) error
+	// AddComment adds comment to the issue.
+	AddComment(ctx context.Context, project string, issue *Issue, body string) error
+	// CloseIssue closes the issue.
+	CloseIssue(ctx context.Context, project string, issue *Issue) error
+}
+
+// NewSimple returns new Simple tracker creating the issues using the given Backend.
+func NewSimple(logger log.FieldLogger, backend Backend, cfg *config.Config) *Simple {
+	return &Simple{
+		backend:         backend,
+		rootRoute:       cfg.Route,
+		closeOnResolve:  cfg.CloseOnResolve,
+		issueAppendMode: cfg.IssueAppendMode,
+		logger:          logger,
+	}
+}
+
+// Simple implements the IssueTracker on top of the basic operations any issue tracking system supports.
+// The alerts are appended to existing issues either to the issue description or as comments.
+type Simple struct {
+	backend         Backend
+	rootRoute       *routing.Route
+	closeOnResolve  bool
+	issueAppendMode string
+	logger          log.FieldLogger
+}
+
+func (s *Simple) createIssue(ctx context.Context, route *routing.Route, msg *alertmanager.Webhook, groupingLabels []string, issueText *bytes.Buffer) error {
+	logger := tracing.Logger(ctx, s.logger)
+	var labels []string
+	labels = append(labels, route.IssueLabels...)
+	labels = append(labels, groupingLabels...)
+	labels = append(labels, ExtractDynamicLabels(route, msg)...)
+	id, err := s.backend.CreateIssue(ctx, route.Project, RenderIssueTitle(logger, route, msg), issueText.String(), labels)
+	if err != nil {
+		metrics.ReportError("FailedToCreateIssue", s.backend.Name())
+		logger.WithFields(log.Fields{"err": err}).Error("failed to create issue")
+		return err
+	}
+	logger.WithFields(log.Fields{"issue_id": id, "project": route.Project, "alert_grouping_key": msg.GroupKey}).Info("created issue")
+	ReportIssueAction(s.backend.Name(), IssueActionCreated)
+	return nil
+}
+
+func (s *Simple) updateIssue(ctx context.Context, route *routing.Route, issue *Issue, issueText *bytes.Buffer) error {
+	logger := tracing.Logger(ctx, s.logger)
+	issue.Labels = IncreaseAppendLabel(logger, issue.Labels)
+	if s.issueAppendMode == config.AppendModeDescription {
+		issue.Description = fmt.Sprintf("%s\n\n%s", issue.Description, FormatAppendedText(issueText))
+	}
+	if err := s.backend.UpdateIssue(ctx, route.Project, issue); err != nil {
+		metrics.ReportError("FailedToUpdateIssue", s.backend.Name())
+		logger.WithFields(log.Fields{"err": err}).Error("failed to update issue, will try to create new")
+		return err
+	}
+	// Discussion threads are not supported by all the trackers, so both the note and discussion modes add a comment.
+	if s.issueAppendMode != config.AppendModeDescription {
+		if err := s.backend.AddComment(ctx, route.Project, issue, FormatAppendedText(issueText)); err != nil {
+			metrics.ReportError("FailedToCommentIssue", s.backend.Name())
+			logger.WithFields(log.Fields{"err": err}).Error("failed to add appended alert as comment to issue")
+			return err
+		}
+	}
+	logger.WithFields(log.Fields{"issue_id": issue.ID, "project": route.Project, "append_mode": s.issueAppendMode}).Info("updated issue")
+	ReportIssueAction(s.backend.Name(), IssueActionUpdated)
+	return nil
+}
+
+func (s *Simple) resolveIssue(ctx context.Context, route *routing.Route, issue *Issue, issueText *bytes.Buffer, closeIssue bool) error {
+	logger := tracing.Logger(ctx, s.logger)
+	if err := s.backend.AddComment(ctx, route.Project, issue, FormatResolvedText(issueText)); err != nil {
+		metrics.ReportError("FailedToCommentIssue", s.backend.Name())
+		logger.WithFields(log.Fields{"err": err}).Error("failed to add resolution comment to issue")
+		return err
+	}
+	logger.WithFields(log.Fields{"issue_id": issue.ID, "project": route.Project}).Info("added resolution comment to issue")
+	ReportIssueAction(s.backend.Name(), IssueActionResolved)
+	if !closeIssue {
+		return nil
+	}
+	if err := s.backend.CloseIssue(ctx, route.Project, issue); err != nil {
+		metrics.ReportError("FailedToCloseIssue", s.backend.Name())
+		logger.WithFields(log.Fields{"err": err}).Error("failed to close issue")
+		return err
+	}
+	logger.WithFields(log.Fields{"issue_id": issue.ID, "project": route.Project}).Info("closed issue")
+	ReportIssueAction(s.backend.Name(), IssueActionClosed)
+	return nil
+}
+
+func (s *Simple) listOpenIssues(ctx context.Context, route *routing.Route, groupingLabels []string, createdAfter *time.Time) ([]*Issue, error) {
+	logger := tracing.Logger(ctx, s.logger)
+	issues, err := s.backend.ListOpenIssues(ctx, route.Project, groupingLabels, createdAfter)
+	if err != nil {
+		metrics.ReportError("ListIssuesError", s.backend.Name())
+		logger.WithFields(log.Fields{"err": err, "labels": groupingLabels}).Error("failed to list issues")
+		return nil, err
+	}
+	return issues, nil
+}
+
+// CreateIssue from the Webhook in the issue tracking system.
+func (s *Simple) CreateIssue(ctx context.Context, msg *alertmanager.Webhook) (err error) {
+	ctx, span := tracing.Start(ctx, "Simple.CreateIssue", trace.WithAttributes(attribute.String("tracker", s.backend.Name()), attribute.String("alert_grouping_key", msg.GroupKey)))
+	defer func() { tracing.EndSpan(span, err) }()
+	logger := tracing.Logger(ctx, s.logger)
+	// Find out where and how to create the issue
+	route := s.rootRoute.Match(msg)
+	logger.WithFields(log.Fields{"alert_grouping_key": msg.GroupKey, "project": route.Project}).Debug("routed alert to project")
+
+	// Extract grouping labels from the message
+	groupingLabels := ExtractGroupingLabels(msg)
+	groupingLabels = append(groupingLabels, route.IssueLabels...)
+
+	issueText, err := RenderIssueTemplate(logger, route, msg)
+	if err != nil {
+		return err
+	}
+
+	if msg.Status == string(model.AlertResolved) {
+		// The issue could have been opened long before the group interval, so look for any open issue.
+		matchingIssues, err := s.listOpenIssues(ctx, route, groupingLabels, nil)
+		if err != nil {
+			return err
+		}
+		if len(matchingIssues) == 0 {
+			logger.WithField("alert_grouping_key", msg.GroupKey).Info("no open issue found for the resolved alert, nothing to do")
+			return nil
+		}
+		closeIssue := s.closeOnResolve && AllAlertsResolved(msg)
+		var lastErr error
+		for _, issue := range matchingIssues {
+			if err := s.resolveIssue(ctx, route, issue, issueText, closeIssue); err != nil {
+				lastErr = err
+			}
+		}
+		return lastErr
+	}
+
+	// Check for existing issues with same grouping labels
+	since := time.Now().Add(-time.Duration(route.GroupInterval))
+	matchingIssues, err := s.listOpenIssues(ctx, route, groupingLabels, &since)
+	if err != nil {
+		logger.Warn("listing of open issues to check for duplicates failed , opening a new one even though possible duplicate")
+	}
+	if len(matchingIssues) > 0 {
+		// Issues are ordered by created date, we update the first so the newest one.
+		issueToUpdate := matchingIssues[0]
+		if err := s.updateIssue(ctx, route, issueToUpdate, issueText); err != nil {
+			logger.WithField("updated_issue_id", issueToUpdate.ID).Warn("updating an existing issue failed, opening a new one")
+		} else {
+			return nil
+		}
+	}
+	// Try to create a new issue rather than discarding it after failed update.
+	return s.createIssue(ctx, route, msg, groupingLabels, issueText)
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 FUSAKLA Martin Chodúr
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/alertmanager"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/issuetemplate"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/metrics"
+	"github.com/fusakla/prometheus-gitlab-notifier/pkg/routing"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// IssueTracker creates issues from the alerts in an issue tracking system.
+type IssueTracker interface {
+	// CreateIssue creates new issue from the Webhook, appends it to an already open issue of the same alert group
+	// or resolves the open issues if the alerts are resolved.
+	// The context carries the trace of processing the alert and is canceled once the processing should stop.
+	CreateIssue(ctx context.Context, msg *alertmanager.Webhook) error
+}
+
+// HealthChecker is implemented by the issue trackers able to check the issue tracking system is reachable and the credentials are valid.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// FormatScopedLabel formats the label as scoped label `key::value`.
+func FormatScopedLabel(key string, value string) string {
+	return fmt.Sprintf("%s::%s", key, value)
+}
+
+// ExtractDynamicLabels returns scoped labels of all the alert labels configured in the route as dynamic labels.
+func ExtractDynamicLabels(route *routing.Route, msg *alertmanager.Webhook) []string {
+	var labelsMap = map[string]string{}
+	for _, a := range msg.Alerts {
+		for k, v := range a.Labels {
+			for _, l := range route.DynamicIssueLabels {
+				if k == l {
+					labelsMap[k] = v
+				}
+			}
+		}
+	}
+	var resLabels []string
+	for k, v := range labelsMap {
+		resLabels = append(resLabels, FormatScopedLabel(k, v))
+	}
+	return resLabels
+}
+
+// ExtractGroupingLabels returns grouping labels of the alert group as scoped labels.
+func ExtractGroupingLabels(msg *alertmanager.Webhook) []string {
+	var resLabels []string
+	for k, v := range msg.GroupLabels {
+		resLabels = append(resLabels, FormatScopedLabel(k, v))
+	}
+	return resLabels
+}
+
+// RenderIssueTemplate renders the issue text using the route issue template with the printed values escaped, see issuetemplate.Execute.
+// If the templating fails, raw JSON of the alert is used instead, so the alert is not lost.
+func RenderIssueTemplate(logger log.FieldLogger, route *routing.Route, msg *alertmanager.Webhook) (*bytes.Buffer, error) {
+	var issueText bytes.Buffer
+	// Try to template the issue text template with the alert data.
+	if err := issuetemplate.Execute(route.IssueTemplate, &issueText, msg.Data); err != nil {
+		// As a fallback we try to add raw JSON of the alert to the issue text, so we don't miss an alert just because of template error.
+		metrics.ReportError("IssueTemplateError", "")
+		logger.WithFields(log.Fields{"err": err}).Error("failed to template issue text, using pure JSON instead")
+		w := bufio.NewWriter(&issueText)
+		_, err := w.WriteString("\n```json\n")
+		if err != nil {
+			metrics.ReportError("JSONWriteError", "")
+			logger.WithFields(log.Fields{"err": err}).Error("failed to write the alert to JSON")
+			return nil, err
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "    ")
+		if err := e.Encode(msg); err != nil {
+			// If even JSON marshalling fails we return error
+			metrics.ReportError("JSONMarshalError", "")
+			logger.WithFields(log.Fields{"err": err}).Error("failed to marshall alert to JSON")
+			return nil, err
+		}
+		_, err = w.WriteString("\n```\n")
+		if err != nil {
+			metrics.ReportError("JSONWriteError", "")
+			logger.WithFields(log.Fields{"err": err}).Error("failed to write the alert to JSON")
+			return nil, err
+		}
+		err = w.Flush()
+		if err != nil {
+			metrics.ReportError("JSONWriteError", "")
+			logger.WithFields(log.Fields{"err": err}).Error("failed to write the alert to JSON")
+			return nil, err
+		}
+	}
+	return &issueText, nil
+}
+
+func defaultIssueTitle(msg *alertmanager.Webhook) string {
+	return fmt.Sprintf("Firing alert `%s`", msg.CommonLabels["alertname"])
+}
+
+// RenderIssueTitle renders the issue title using the route title template, falls back to the default title if it fails.
+func RenderIssueTitle(logger log.FieldLogger, route *routing.Route, msg *alertmanager.Webhook) string {
+	if route.IssueTitleTemplate == nil {
+		return defaultIssueTitle(msg)
+	}
+	var issueTitle bytes.Buffer
+	if err := route.IssueTitleTemplate.Execute(&issueTitle, msg.Data); err != nil {
+		// Do not lose the alert just because of broken title template, fall back to the default title.
+		metrics.ReportError("IssueTitleTemplateError", "")
+		logger.WithFields(log.Fields{"err": err}).Error("failed to template issue title, using the default one instead")
+		return defaultIssueTitle(msg)
+	}
+	// Issue trackers do not allow multi-line titles.
+	title := strings.Join(strings.Fields(issueTitle.String()), " ")
+	if title == "" {
+		logger.Warn("issue title template rendered to empty string, using the default one instead")
+		return defaultIssueTitle(msg)
+	}
+	return title
+}
+
+// IncreaseAppendLabel increases the number in the `appended-alerts::<number>` label or adds it if missing.
+func IncreaseAppendLabel(logger log.FieldLogger, labels []string) []string {
+	// Every updated issue has special label containing number of updates
+	appendLabelRegex := regexp.MustCompile(`(appended-alerts)::(\d+)`)
+	alreadyAppended := false
+	var newLabels []string
+	for _, l := range labels {
+		// Check if the label is the special one
+		matched := appendLabelRegex.FindStringSubmatch(l)
+		if len(matched) == 3 {
+			alreadyAppended = true
+			// Convert it to number if possible otherwise leave the old one as is
+			count, err := strconv.Atoi(matched[2])
+			if err != nil {
+				logger.WithFields(log.Fields{"err": err, "label_value": l}).Error("failed to parse issue label `appended-alerts`, leaving it unmodified")
+				newLabels = append(newLabels, l)
+				continue
+			}
+			// Increase the number of appends and add override the old label with it
+			newLabels = append(newLabels, FormatScopedLabel(matched[1], strconv.Itoa(count+1)))
+			continue
+		}
+		newLabels = append(newLabels, l)
+	}
+	if !alreadyAppended {
+		newLabels = append(newLabels, FormatScopedLabel("appended-alerts", "1"))
+	}
+	return newLabels
+}
+
+// FormatResolvedText prefixes the rendered resolved alert with the time it was resolved.
+func FormatResolvedText(issueText *bytes.Buffer) string {
+	return fmt.Sprintf("_Resolved on `%s`_\n%s", time.Now().Local(), issueText.String())
+}
+
+// FormatAppendedText prefixes the rendered alert appended to an existing issue with the time it was appended.
+func FormatAppendedText(issueText *bytes.Buffer) string {
+	return fmt.Sprintf("_Appended on `%s`_\n%s", time.Now().Local(), issueText.String())
+}
+
+// AllAlertsResolved returns true if all the alerts of the group are resolved.
+func AllAlertsResolved(msg *alertmanager.Webhook) bool {
+	for _, a := range msg.Alerts {
+		if a.Status != string(model.AlertResolved) {
+			return false
+		}
+	}
+	return true
+}